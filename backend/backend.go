@@ -18,6 +18,14 @@ var (
 	// NotLockedByMe indicates that the state is locked by
 	// another person and that any procedures should not be done.
 	NotLockedByMe = errors.New("state is not locked by me")
+
+	// HistoryNotSupported indicates that the storage type
+	// doesn't keep the history of states.
+	HistoryNotSupported = errors.New("storage type does not support state history")
+
+	// LockRenewNotSupported indicates that the storage type
+	// can't renew locks, or that locks don't expire at all.
+	LockRenewNotSupported = errors.New("lock renewal is not supported")
 )
 
 // ParseRequestData is parsing request data to the requests
@@ -34,10 +42,18 @@ func ParseRequestData(params *gin.Context) (*storagetypes.ClientData, error) {
 	}
 
 	requestData.Metadata = storageClient.CreateParams(params)
+	setLockID(&requestData, requestData.ID)
 
 	return &requestData, nil
 }
 
+// setLockID tells the storage client which lock the caller holds, see storage.LockIDMetadata.
+func setLockID(requestData *storagetypes.ClientData, id string) {
+	if lockMetadata, ok := requestData.Metadata.(storage.LockIDMetadata); ok {
+		lockMetadata.SetLockID(id)
+	}
+}
+
 // LockState is trying to lock the current Terraform state.
 // Returning StateIsLocked will also return the given
 // lock info for the already acquired lock.
@@ -54,12 +70,31 @@ func LockState(requestData *storagetypes.ClientData, rawLockData []byte) (*stora
 		return nil, err
 	}
 
+	// Expired locks are treated as if they were released
+	if lockData != nil && lockData.Expired() {
+		if lockData, err = releaseExpiredLock(storageClient, requestData, lockData.ID); err != nil {
+			return nil, err
+		}
+	}
+
 	// State is already locked, we can't proceed
 	if lockData != nil {
 		return lockData, StateIsLocked
 	}
 
+	if rawLockData, err = withExpiry(rawLockData); err != nil {
+		return nil, err
+	}
+
 	if err := storageClient.LockState(requestData.Metadata, rawLockData); err != nil {
+		// Someone else acquired the lock in the meantime
+		if errors.Is(err, storagetypes.ErrLockExists) {
+			lockData, lockErr := storageClient.GetLockData(requestData.Metadata)
+			if lockErr != nil {
+				return nil, lockErr
+			}
+			return lockData, StateIsLocked
+		}
 		return nil, err
 	}
 
@@ -81,6 +116,7 @@ func UnlockState(requestData *storagetypes.ClientData, rawLockData []byte) error
 		}
 
 		requestData.ID = lock.ID
+		setLockID(requestData, lock.ID)
 	}
 
 	storageClient, err := storage.GetStorageClient(*requestData)
@@ -112,18 +148,7 @@ func GetState(requestData *storagetypes.ClientData) ([]byte, error) {
 		return nil, err
 	}
 
-	provider, err := encryption.GetEncryptionProvider()
-	if err != nil {
-		return nil, err
-	}
-
-	if provider != nil {
-		if state, err = provider.Decrypt(state); err != nil {
-			return nil, err
-		}
-	}
-
-	return state, nil
+	return decryptState(state)
 }
 
 // UpdateState updates the raw json state in the storage client.
@@ -138,6 +163,11 @@ func UpdateState(requestData *storagetypes.ClientData, body []byte) error {
 		return err
 	}
 
+	// Storage clients can't read the state once it's encrypted
+	if updateMetadata, ok := requestData.Metadata.(storage.StateUpdateMetadata); ok {
+		updateMetadata.SetStateUpdate(describeStateUpdate(requestData, storageClient, body))
+	}
+
 	provider, err := encryption.GetEncryptionProvider()
 	if err != nil {
 		return err
@@ -160,6 +190,22 @@ func DeleteState() {
 	panic(errors.New("not implemented"))
 }
 
+// decryptState decrypts the raw state with the configured encryption provider, if any.
+func decryptState(state []byte) ([]byte, error) {
+	provider, err := encryption.GetEncryptionProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	if provider != nil {
+		if state, err = provider.Decrypt(state); err != nil {
+			return nil, err
+		}
+	}
+
+	return state, nil
+}
+
 func lockedByMe(data *storagetypes.ClientData, client storage.Client) error {
 	lockInfo, err := client.GetLockData(data.Metadata)
 	if err != nil {
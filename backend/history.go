@@ -0,0 +1,79 @@
+package backend
+
+import (
+	"encoding/json"
+	"terraform-backend-http-proxy/storage"
+	"terraform-backend-http-proxy/storage/storagetypes"
+)
+
+// terraformStateMeta is the part of the Terraform state identifying its version.
+type terraformStateMeta struct {
+	Serial  uint64 `json:"serial"`
+	Lineage string `json:"lineage"`
+}
+
+// GetStateVersions lists the stored versions of the state, newest first.
+// The serial and lineage are recorded by the storage when storing the state. Versions stored before that
+// are read from the state the storage listed them with, so only those get decrypted.
+func GetStateVersions(requestData *storagetypes.ClientData) ([]storagetypes.StateVersion, error) {
+	historyClient, err := getHistoryClient(requestData)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := historyClient.GetStateVersions(requestData.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range versions {
+		if versions[i].State == nil {
+			continue
+		}
+
+		// Versions which can't be decrypted or aren't a valid Terraform state are still listed
+		state, err := decryptState(versions[i].State)
+		if err != nil {
+			continue
+		}
+
+		var meta terraformStateMeta
+		if err := json.Unmarshal(state, &meta); err != nil {
+			continue
+		}
+
+		versions[i].Serial = meta.Serial
+		versions[i].Lineage = meta.Lineage
+	}
+
+	return versions, nil
+}
+
+// GetStateVersion will get the raw json state at the given version from the storage client.
+func GetStateVersion(requestData *storagetypes.ClientData, version string) ([]byte, error) {
+	historyClient, err := getHistoryClient(requestData)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := historyClient.GetStateVersion(requestData.Metadata, version)
+	if err != nil {
+		return nil, err
+	}
+
+	return decryptState(state)
+}
+
+func getHistoryClient(requestData *storagetypes.ClientData) (storage.HistoryClient, error) {
+	storageClient, err := storage.GetStorageClient(*requestData)
+	if err != nil {
+		return nil, err
+	}
+
+	historyClient, ok := storageClient.(storage.HistoryClient)
+	if !ok {
+		return nil, HistoryNotSupported
+	}
+
+	return historyClient, nil
+}
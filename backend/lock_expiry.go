@@ -0,0 +1,115 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"terraform-backend-http-proxy/storage"
+	"terraform-backend-http-proxy/storage/storagetypes"
+	"time"
+)
+
+// lockTTL returns how long locks are valid unless renewed, configured with TF_BACKEND_HTTP_LOCK_TTL.
+// It's 0 if locks never expire.
+func lockTTL() (time.Duration, error) {
+	ttl, ok := os.LookupEnv("TF_BACKEND_HTTP_LOCK_TTL")
+	if !ok {
+		return 0, nil
+	}
+
+	return time.ParseDuration(ttl)
+}
+
+// withExpiry sets the expiry of the raw lock data if locks expire.
+func withExpiry(rawLockData []byte) ([]byte, error) {
+	ttl, err := lockTTL()
+	if err != nil || ttl <= 0 {
+		return rawLockData, err
+	}
+
+	var lockInfo storagetypes.LockInfo
+	if err := json.Unmarshal(rawLockData, &lockInfo); err != nil {
+		return nil, err
+	}
+
+	expires := time.Now().UTC().Add(ttl)
+	lockInfo.Expires = &expires
+
+	return json.Marshal(lockInfo)
+}
+
+// releaseExpiredLock releases the lock with the given id, if it's still held and expired.
+// Storage clients only release that very lock while it's still expired, it might be renewed or replaced concurrently.
+// It returns the lock held instead, nil if the state isn't locked anymore.
+func releaseExpiredLock(client storage.Client, requestData *storagetypes.ClientData, id string) (*storagetypes.LockInfo, error) {
+	// Someone else might have released the expired lock and acquired a new one in the meantime
+	lockData, err := client.GetLockData(requestData.Metadata)
+	if err != nil {
+		if errors.Is(err, storagetypes.ErrLockMissing) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if lockData.ID != id || !lockData.Expired() {
+		return lockData, nil
+	}
+
+	setLockID(requestData, id)
+
+	if metadata, ok := requestData.Metadata.(storage.ExpiredLockMetadata); ok {
+		metadata.SetExpiredOnly()
+	}
+
+	if err := client.UnlockState(requestData.Metadata); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// RenewLock extends the expiry of the lock held by the caller by another TF_BACKEND_HTTP_LOCK_TTL.
+// Wrapper tools call it periodically during long running operations, so the lock doesn't expire meanwhile.
+func RenewLock(requestData *storagetypes.ClientData) (*storagetypes.LockInfo, error) {
+	ttl, err := lockTTL()
+	if err != nil {
+		return nil, err
+	}
+
+	if ttl <= 0 {
+		return nil, LockRenewNotSupported
+	}
+
+	storageClient, err := storage.GetStorageClient(*requestData)
+	if err != nil {
+		return nil, err
+	}
+
+	renewClient, ok := storageClient.(storage.LockRenewClient)
+	if !ok {
+		return nil, LockRenewNotSupported
+	}
+
+	lockData, err := storageClient.GetLockData(requestData.Metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	if lockData.ID != requestData.ID {
+		return nil, NotLockedByMe
+	}
+
+	expires := time.Now().UTC().Add(ttl)
+	lockData.Expires = &expires
+
+	rawLockData, err := json.Marshal(lockData)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := renewClient.RenewLock(requestData.Metadata, rawLockData); err != nil {
+		return nil, err
+	}
+
+	return lockData, nil
+}
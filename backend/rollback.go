@@ -0,0 +1,77 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"terraform-backend-http-proxy/storage"
+	"terraform-backend-http-proxy/storage/storagetypes"
+)
+
+// LineageMismatch indicates that the version to restore
+// belongs to another state than the current one.
+var LineageMismatch = errors.New("state lineage does not match")
+
+// RollbackState restores the state at the given version by storing it as a new version.
+// The serial is bumped past the current one, so Terraform accepts the restored state.
+// It's a requirement that the lock is acquired by the one doing the rollback.
+func RollbackState(requestData *storagetypes.ClientData, version string) error {
+	storageClient, err := storage.GetStorageClient(*requestData)
+	if err != nil {
+		return err
+	}
+
+	// We can only roll back state if we obtained the lock
+	if err := lockedByMe(requestData, storageClient); err != nil {
+		return err
+	}
+
+	state, err := GetStateVersion(requestData, version)
+	if err != nil {
+		return err
+	}
+
+	current, err := GetState(requestData)
+	if err != nil {
+		return err
+	}
+
+	restored, err := bumpSerial(state, current)
+	if err != nil {
+		return err
+	}
+
+	return UpdateState(requestData, restored)
+}
+
+// bumpSerial sets the serial of the state to follow the serial of the current state.
+func bumpSerial(state, current []byte) ([]byte, error) {
+	var currentMeta terraformStateMeta
+	if err := json.Unmarshal(current, &currentMeta); err != nil {
+		return nil, err
+	}
+
+	var stateMeta terraformStateMeta
+	if err := json.Unmarshal(state, &stateMeta); err != nil {
+		return nil, err
+	}
+
+	if stateMeta.Lineage != currentMeta.Lineage {
+		return nil, fmt.Errorf("%w: %q is not %q", LineageMismatch, stateMeta.Lineage, currentMeta.Lineage)
+	}
+
+	// Keep all other fields as they are
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(state, &fields); err != nil {
+		return nil, err
+	}
+
+	serial, err := json.Marshal(currentMeta.Serial + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	fields["serial"] = serial
+
+	return json.MarshalIndent(fields, "", "  ")
+}
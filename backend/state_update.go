@@ -0,0 +1,128 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"terraform-backend-http-proxy/storage"
+	"terraform-backend-http-proxy/storage/storagetypes"
+)
+
+// terraformState is the part of the Terraform state state updates are described with.
+type terraformState struct {
+	Serial    *uint64 `json:"serial"`
+	Lineage   string  `json:"lineage"`
+	Resources []struct {
+		Module    string            `json:"module"`
+		Mode      string            `json:"mode"`
+		Type      string            `json:"type"`
+		Name      string            `json:"name"`
+		Instances []json.RawMessage `json:"instances"`
+	} `json:"resources"`
+}
+
+// describeStateUpdate describes the plain state replacing the currently stored one, see storage.StateUpdateMetadata.
+func describeStateUpdate(requestData *storagetypes.ClientData, storageClient storage.Client, state []byte) *storagetypes.StateUpdate {
+	update := &storagetypes.StateUpdate{}
+
+	// States not being a valid Terraform state are still stored
+	current, ok := parseTerraformState(state)
+	if !ok {
+		return update
+	}
+
+	update.Serial = current.Serial
+	update.Lineage = current.Lineage
+
+	previous, ok := readPreviousState(requestData, storageClient)
+	if !ok {
+		return update
+	}
+
+	if previous.Serial != nil {
+		update.PreviousSerial = *previous.Serial
+	}
+
+	instances := current.instances()
+	previousInstances := previous.instances()
+
+	update.Resources = len(instances)
+	update.PreviousResources = len(previousInstances)
+
+	for address, instance := range instances {
+		previousInstance, ok := previousInstances[address]
+		switch {
+		case !ok:
+			update.Added++
+		case previousInstance != instance:
+			update.Changed++
+		}
+	}
+
+	for address := range previousInstances {
+		if _, ok := instances[address]; !ok {
+			update.Removed++
+		}
+	}
+
+	return update
+}
+
+// readPreviousState reads the currently stored state, which is empty if there's none yet.
+// It returns false if it couldn't be read, the update is described without comparing to it then.
+func readPreviousState(requestData *storagetypes.ClientData, storageClient storage.Client) (*terraformState, bool) {
+	state, err := storageClient.GetState(requestData.Metadata)
+	if errors.Is(err, os.ErrNotExist) {
+		return &terraformState{}, true
+	}
+	if err != nil {
+		return nil, false
+	}
+
+	if state, err = decryptState(state); err != nil {
+		return nil, false
+	}
+
+	return parseTerraformState(state)
+}
+
+// parseTerraformState returns false if the state isn't a Terraform state.
+func parseTerraformState(state []byte) (*terraformState, bool) {
+	var parsed terraformState
+	if err := json.Unmarshal(state, &parsed); err != nil {
+		return nil, false
+	}
+
+	return &parsed, true
+}
+
+// instances maps the resource instances by their address to their encoded attributes.
+func (state *terraformState) instances() map[string]string {
+	instances := make(map[string]string)
+
+	for _, resource := range state.Resources {
+		address := resource.Type + "." + resource.Name
+		if resource.Mode == "data" {
+			address = "data." + address
+		}
+		if resource.Module != "" {
+			address = resource.Module + "." + address
+		}
+
+		for _, instance := range resource.Instances {
+			var key struct {
+				IndexKey json.RawMessage `json:"index_key"`
+			}
+			_ = json.Unmarshal(instance, &key)
+
+			instanceAddress := address
+			if key.IndexKey != nil {
+				instanceAddress += "[" + string(key.IndexKey) + "]"
+			}
+
+			instances[instanceAddress] = string(instance)
+		}
+	}
+
+	return instances
+}
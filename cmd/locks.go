@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"terraform-backend-http-proxy/storage/git"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// locksGCOptions configures which locks are deleted
+var locksGCOptions git.LockGCOptions
+
+// locksCmd represents the locks command
+var locksCmd = &cobra.Command{
+	Use:   "locks",
+	Short: "Manages locks held on Git repositories",
+}
+
+// locksGCCmd represents the locks gc command
+var locksGCCmd = &cobra.Command{
+	Use:   "gc <repository>",
+	Short: "Deletes stale locks of a Git repository",
+	Long: `Lists the locks held on a Git repository with their age and holder,
+and deletes those left behind by crashed Terraform runs.
+
+Locks are deleted if they are older than --older-than, or with
+--missing-state if their state doesn't exist (anymore). Locks with an
+expiry are only deleted once they expired, since their holder renews
+them while still running. Use --dry-run to only report which locks
+would be deleted.
+
+Git credentials are discovered in the environment, same as when serving.`,
+	Args: cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := locksGC(args[0]); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	locksGCCmd.Flags().DurationVar(&locksGCOptions.MaxAge, "older-than", 0, "delete locks older than this, e.g. 24h")
+	locksGCCmd.Flags().BoolVar(&locksGCOptions.MissingState, "missing-state", false, "delete locks of states that don't exist")
+	locksGCCmd.Flags().BoolVar(&locksGCOptions.DryRun, "dry-run", false, "only report which locks would be deleted")
+	locksCmd.AddCommand(locksGCCmd)
+	rootCmd.AddCommand(locksCmd)
+}
+
+func locksGC(repository string) error {
+	locks, err := git.CollectLocks(repository, locksGCOptions)
+	if err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "REF\tWHO\tAGE\tACTION")
+
+	for _, lock := range locks {
+		action := "keep"
+		switch {
+		case lock.Error != "":
+			action = "keep, inspection failed: " + lock.Error
+		case lock.Deleted:
+			action = "deleted: " + lock.Stale
+		case lock.Stale != "" && locksGCOptions.DryRun:
+			action = "would delete: " + lock.Stale
+		case lock.Stale != "":
+			action = "delete failed: " + lock.Stale
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", lock.Ref, lock.Info.Who, lock.Age.Round(time.Second), action)
+	}
+
+	return writer.Flush()
+}
@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"path"
+	"terraform-backend-http-proxy/storage/storagetypes"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// rollbackLockID is the id of a lock already held by the caller
+var rollbackLockID string
+
+// rollbackCmd represents the rollback command
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback <address> <version>",
+	Short: "Rolls back a state to a previous version",
+	Long: `Rolls back a state to a previous version by storing it as a new version
+with a bumped serial. The address is the backend address as configured in
+Terraform, and the version one of the versions listed at /versions.
+
+The state is locked while rolling back, unless the id of an already
+held lock is given with --lock-id.`,
+	Args: cobra.ExactArgs(2),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := rollback(args[0], args[1]); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rollbackCmd.Flags().StringVar(&rollbackLockID, "lock-id", "", "id of a lock already held on the state")
+	rootCmd.AddCommand(rollbackCmd)
+}
+
+func rollback(address, version string) error {
+	stateURL, err := url.Parse(address)
+	if err != nil {
+		return err
+	}
+
+	lockID := rollbackLockID
+	if lockID == "" {
+		lockInfo, err := newRollbackLockInfo()
+		if err != nil {
+			return err
+		}
+
+		rawLockInfo, err := json.Marshal(lockInfo)
+		if err != nil {
+			return err
+		}
+
+		if err := request("LOCK", stateURL, rawLockInfo); err != nil {
+			return fmt.Errorf("could not lock state: %w", err)
+		}
+		defer func() {
+			if err := request("UNLOCK", stateURL, rawLockInfo); err != nil {
+				log.Printf("could not unlock state, unlock it with lock id %s: %s", lockInfo.ID, err)
+			}
+		}()
+
+		lockID = lockInfo.ID
+	}
+
+	rollbackURL := *stateURL
+	rollbackURL.Path = path.Join(stateURL.Path, "versions", version, "rollback")
+
+	query := rollbackURL.Query()
+	query.Set("ID", lockID)
+	rollbackURL.RawQuery = query.Encode()
+
+	if err := request(http.MethodPost, &rollbackURL, nil); err != nil {
+		return fmt.Errorf("could not roll back state: %w", err)
+	}
+
+	fmt.Printf("Rolled back to version %s\n", version)
+
+	return nil
+}
+
+func newRollbackLockInfo() (*storagetypes.LockInfo, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	who := "unknown"
+	if u, err := user.Current(); err == nil {
+		who = u.Username
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		who += "@" + hostname
+	}
+
+	return &storagetypes.LockInfo{
+		ID:        hex.EncodeToString(id),
+		Operation: "OperationTypeRollback",
+		Who:       who,
+		Version:   Version,
+		Created:   time.Now().UTC(),
+	}, nil
+}
+
+// request sends the request to the backend and fails on any non-successful response.
+func request(method string, u *url.URL, body []byte) error {
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		message, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("%s: %s", res.Status, message)
+	}
+
+	return nil
+}
@@ -13,3 +13,17 @@ func ServerError(c *gin.Context, err error) {
 	})
 	panic(err)
 }
+
+func UntrustedState(c *gin.Context, err error) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":   "UntrustedState",
+		"message": err.Error(),
+	})
+}
+
+func NotImplemented(c *gin.Context, err error) {
+	c.JSON(http.StatusNotImplemented, gin.H{
+		"error":   "NotImplemented",
+		"message": err.Error(),
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"terraform-backend-http-proxy/backend"
 	"terraform-backend-http-proxy/server/internal/ginutils"
 	"terraform-backend-http-proxy/server/internal/middleware"
+	"terraform-backend-http-proxy/storage/storagetypes"
 )
 
 func GetState(c *gin.Context) {
@@ -20,6 +21,11 @@ func GetState(c *gin.Context) {
 			return
 		}
 
+		if errors.Is(err, storagetypes.ErrUntrustedState) {
+			ginutils.UntrustedState(c, err)
+			return
+		}
+
 		ginutils.ServerError(c, err)
 		return
 	}
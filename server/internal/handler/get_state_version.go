@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"os"
+	"terraform-backend-http-proxy/backend"
+	"terraform-backend-http-proxy/server/internal/ginutils"
+	"terraform-backend-http-proxy/server/internal/middleware"
+	"terraform-backend-http-proxy/storage/storagetypes"
+)
+
+func GetStateVersion(c *gin.Context) {
+	requestData := middleware.ReadRequestData(c)
+
+	state, err := backend.GetStateVersion(requestData, c.Param("version"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+
+		if errors.Is(err, storagetypes.ErrUntrustedState) {
+			ginutils.UntrustedState(c, err)
+			return
+		}
+
+		if errors.Is(err, backend.HistoryNotSupported) {
+			ginutils.NotImplemented(c, err)
+			return
+		}
+
+		ginutils.ServerError(c, err)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json", state)
+}
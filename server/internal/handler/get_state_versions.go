@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"terraform-backend-http-proxy/backend"
+	"terraform-backend-http-proxy/server/internal/ginutils"
+	"terraform-backend-http-proxy/server/internal/middleware"
+)
+
+func GetStateVersions(c *gin.Context) {
+	requestData := middleware.ReadRequestData(c)
+
+	versions, err := backend.GetStateVersions(requestData)
+	if err != nil {
+		if errors.Is(err, backend.HistoryNotSupported) {
+			ginutils.NotImplemented(c, err)
+			return
+		}
+
+		ginutils.ServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
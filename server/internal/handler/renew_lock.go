@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"terraform-backend-http-proxy/backend"
+	"terraform-backend-http-proxy/server/internal/ginutils"
+	"terraform-backend-http-proxy/server/internal/middleware"
+	"terraform-backend-http-proxy/storage/storagetypes"
+)
+
+func RenewLock(c *gin.Context) {
+	requestData := middleware.ReadRequestData(c)
+
+	lockInfo, err := backend.RenewLock(requestData)
+	if err != nil {
+		if errors.Is(err, backend.NotLockedByMe) || errors.Is(err, storagetypes.ErrLockMissing) {
+			c.JSON(http.StatusLocked, gin.H{
+				"error":   "NotLockedByMe",
+				"message": "the state must be locked by the caller to renew the lock",
+			})
+			return
+		}
+
+		if errors.Is(err, backend.LockRenewNotSupported) {
+			ginutils.NotImplemented(c, err)
+			return
+		}
+
+		ginutils.ServerError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, lockInfo)
+}
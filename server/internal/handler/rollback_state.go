@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"os"
+	"terraform-backend-http-proxy/backend"
+	"terraform-backend-http-proxy/server/internal/ginutils"
+	"terraform-backend-http-proxy/server/internal/middleware"
+	"terraform-backend-http-proxy/storage/storagetypes"
+)
+
+func RollbackState(c *gin.Context) {
+	requestData := middleware.ReadRequestData(c)
+
+	if err := backend.RollbackState(requestData, c.Param("version")); err != nil {
+		if errors.Is(err, backend.NotLockedByMe) || errors.Is(err, storagetypes.ErrLockMissing) {
+			c.JSON(http.StatusLocked, gin.H{
+				"error":   "NotLockedByMe",
+				"message": "the state must be locked by the caller to roll back",
+			})
+			return
+		}
+
+		if errors.Is(err, os.ErrNotExist) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+
+		if errors.Is(err, storagetypes.ErrUntrustedState) {
+			ginutils.UntrustedState(c, err)
+			return
+		}
+
+		if errors.Is(err, backend.LineageMismatch) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "LineageMismatch",
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if errors.Is(err, backend.HistoryNotSupported) {
+			ginutils.NotImplemented(c, err)
+			return
+		}
+
+		ginutils.ServerError(c, err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
@@ -7,6 +7,14 @@ import (
 )
 
 func Run() {
+	err := newRouter().Run("localhost:6061")
+	if err != nil {
+		panic(err)
+	}
+}
+
+// newRouter routes the requests of the Terraform HTTP backend to their handlers.
+func newRouter() *gin.Engine {
 	r := gin.Default()
 
 	r.Use(middleware.BodyLog)
@@ -17,9 +25,11 @@ func Run() {
 	r.DELETE("/", handler.DeleteState)
 	r.Handle("LOCK", "/", handler.LockState)
 	r.Handle("UNLOCK", "/", handler.UnlockState)
+	r.POST("/lock/renew", handler.RenewLock)
 
-	err := r.Run("localhost:6061")
-	if err != nil {
-		panic(err)
-	}
+	r.GET("/versions", handler.GetStateVersions)
+	r.GET("/versions/:version", handler.GetStateVersion)
+	r.POST("/versions/:version/rollback", handler.RollbackState)
+
+	return r
 }
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"terraform-backend-http-proxy/storage/storagetypes"
+	"testing"
+	"time"
+)
+
+const testState = `{"version": 4, "serial": 1, "lineage": "test", "resources": []}`
+
+// newBareRepository creates a bare repository with an initial commit on main.
+func newBareRepository(t *testing.T) string {
+	dir := t.TempDir()
+
+	if _, err := git.PlainInit(dir, true); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := memfs.New()
+	repository, err := git.Init(memory.NewStorage(), fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := fs.Create("README")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write([]byte("states\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, err := repository.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tree.Add("README"); err != nil {
+		t.Fatal(err)
+	}
+
+	commitOptions := git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@localhost", When: time.Now()},
+	}
+	if _, err := tree.Commit("Initial commit", &commitOptions); err != nil {
+		t.Fatal(err)
+	}
+
+	remote, err := repository.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{dir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pushOptions := git.PushOptions{
+		RefSpecs: []config.RefSpec{"refs/heads/master:refs/heads/main"},
+	}
+	if err := remote.Push(&pushOptions); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+// request sends a request for the state in the repository to the router and returns the response.
+func request(router *gin.Engine, method, repository, lockID, body string) *httptest.ResponseRecorder {
+	query := url.Values{
+		"type":       {"git"},
+		"repository": {repository},
+		"ref":        {"main"},
+		"state":      {"test.tfstate"},
+	}
+
+	if lockID != "" {
+		query.Set("ID", lockID)
+	}
+
+	req := httptest.NewRequest(method, "/?"+query.Encode(), strings.NewReader(body))
+
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	return res
+}
+
+func lockBody(id string) string {
+	return `{"ID": "` + id + `", "Operation": "OperationTypeApply", "Who": "test@localhost", "Version": "1.3.0"}`
+}
+
+func assertStatus(t *testing.T, res *httptest.ResponseRecorder, want int) {
+	t.Helper()
+
+	if res.Code != want {
+		t.Fatalf("status = %d, want %d: %s", res.Code, want, res.Body)
+	}
+}
+
+func TestGitStorage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	dir := newBareRepository(t)
+
+	repositories := map[string]string{
+		"path":     dir,
+		"file URL": "file://" + dir,
+	}
+
+	for name, repository := range repositories {
+		t.Run(name, func(t *testing.T) {
+			router := newRouter()
+
+			assertStatus(t, request(router, "LOCK", repository, "", lockBody("L")), http.StatusOK)
+			assertStatus(t, request(router, http.MethodPost, repository, "L", testState), http.StatusOK)
+
+			res := request(router, http.MethodGet, repository, "", "")
+			assertStatus(t, res, http.StatusOK)
+
+			if res.Body.String() != testState {
+				t.Errorf("state = %s, want %s", res.Body, testState)
+			}
+
+			assertStatus(t, request(router, "UNLOCK", repository, "", lockBody("L")), http.StatusOK)
+
+			// The lock was released, so it can be acquired again
+			assertStatus(t, request(router, "LOCK", repository, "", lockBody("M")), http.StatusOK)
+			assertStatus(t, request(router, "UNLOCK", repository, "", lockBody("M")), http.StatusOK)
+		})
+	}
+}
+
+func TestGitStorageLockConflict(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	repository := "file://" + newBareRepository(t)
+	router := newRouter()
+
+	assertStatus(t, request(router, "LOCK", repository, "", lockBody("L")), http.StatusOK)
+
+	res := request(router, "LOCK", repository, "", lockBody("M"))
+	assertStatus(t, res, http.StatusLocked)
+
+	var lockInfo storagetypes.LockInfo
+	if err := json.Unmarshal(res.Body.Bytes(), &lockInfo); err != nil {
+		t.Fatal(err)
+	}
+
+	if lockInfo.ID != "L" {
+		t.Errorf("locked by %q, want L", lockInfo.ID)
+	}
+
+	// Only the holder can update the state
+	res = request(router, http.MethodPost, repository, "M", testState)
+	if res.Code == http.StatusOK {
+		t.Error("updated the state locked by someone else")
+	}
+}
@@ -0,0 +1,169 @@
+package file
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"os"
+	"sync"
+	"terraform-backend-http-proxy/storage/internal"
+	"terraform-backend-http-proxy/storage/storagetypes"
+)
+
+// StorageClient implementation for local filesystem storage type
+type StorageClient struct {
+	// locksMutex used for locking while a lock file is read and then released or renewed,
+	// so it's the very lock read that gets changed
+	locksMutex sync.Mutex
+}
+
+// NewStorageClient creates new StorageClient
+func NewStorageClient() *StorageClient {
+	return &StorageClient{
+		locksMutex: sync.Mutex{},
+	}
+}
+
+func (client *StorageClient) CreateParams(params *gin.Context) storage.ClientTypeMetadata {
+	return &requestMetadataParams{
+		State: params.Query("state"),
+	}
+}
+
+func (client *StorageClient) GetLockData(data storage.ClientTypeMetadata) (*storagetypes.LockInfo, error) {
+	params := data.(*requestMetadataParams)
+
+	lockPath, err := resolvePath(getLockPath(params))
+	if err != nil {
+		return nil, err
+	}
+
+	return readLock(lockPath)
+}
+
+func (client *StorageClient) LockState(data storage.ClientTypeMetadata, rawLockData []byte) error {
+	params := data.(*requestMetadataParams)
+
+	lockPath, err := resolvePath(getLockPath(params))
+	if err != nil {
+		return err
+	}
+
+	if err := createExclusive(lockPath, rawLockData); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return storagetypes.ErrLockExists
+		}
+		return err
+	}
+
+	return nil
+}
+
+// UnlockState only releases the lock of the caller, it might have been released and acquired by someone else meanwhile.
+func (client *StorageClient) UnlockState(data storage.ClientTypeMetadata) error {
+	params := data.(*requestMetadataParams)
+
+	lockPath, err := resolvePath(getLockPath(params))
+	if err != nil {
+		return err
+	}
+
+	client.locksMutex.Lock()
+	defer client.locksMutex.Unlock()
+
+	lockInfo, err := readLock(lockPath)
+	if err != nil {
+		if errors.Is(err, storagetypes.ErrLockMissing) {
+			return nil
+		}
+		return err
+	}
+
+	if lockInfo.ID != params.lockID {
+		return nil
+	}
+
+	// The expired lock was renewed in the meantime
+	if params.expiredOnly && !lockInfo.Expired() {
+		return nil
+	}
+
+	if err := os.Remove(lockPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// RenewLock only replaces the lock file if it still holds the same lock.
+func (client *StorageClient) RenewLock(data storage.ClientTypeMetadata, rawLockData []byte) error {
+	params := data.(*requestMetadataParams)
+
+	var renewed storagetypes.LockInfo
+	if err := json.Unmarshal(rawLockData, &renewed); err != nil {
+		return err
+	}
+
+	lockPath, err := resolvePath(getLockPath(params))
+	if err != nil {
+		return err
+	}
+
+	client.locksMutex.Lock()
+	defer client.locksMutex.Unlock()
+
+	lockInfo, err := readLock(lockPath)
+	if err != nil {
+		return err
+	}
+
+	if lockInfo.ID != renewed.ID {
+		return storagetypes.ErrLockMissing
+	}
+
+	return writeAtomic(lockPath, rawLockData)
+}
+
+func (client *StorageClient) GetState(data storage.ClientTypeMetadata) ([]byte, error) {
+	params := data.(*requestMetadataParams)
+
+	statePath, err := resolvePath(params.State)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.ReadFile(statePath)
+}
+
+func (client *StorageClient) UpdateState(data storage.ClientTypeMetadata, state []byte) error {
+	params := data.(*requestMetadataParams)
+
+	statePath, err := resolvePath(params.State)
+	if err != nil {
+		return err
+	}
+
+	return writeAtomic(statePath, state)
+}
+
+// readLock reads the lock file, it fails with storagetypes.ErrLockMissing if the state isn't locked.
+func readLock(lockPath string) (*storagetypes.LockInfo, error) {
+	lock, err := os.ReadFile(lockPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, storagetypes.ErrLockMissing
+		}
+		return nil, err
+	}
+
+	var lockInfo storagetypes.LockInfo
+	if err := json.Unmarshal(lock, &lockInfo); err != nil {
+		return nil, err
+	}
+
+	return &lockInfo, nil
+}
+
+func getLockPath(params *requestMetadataParams) string {
+	return params.State + ".lock"
+}
@@ -0,0 +1,80 @@
+package file
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// rootDir returns the directory all states and locks are kept under.
+// It's configured with TF_BACKEND_HTTP_FILE_ROOT and defaults to the working directory.
+func rootDir() string {
+	if root, ok := os.LookupEnv("TF_BACKEND_HTTP_FILE_ROOT"); ok && root != "" {
+		return root
+	}
+
+	return "."
+}
+
+// resolvePath resolves the requested path within the root directory.
+// Paths trying to escape the root directory are confined to it.
+func resolvePath(path string) (string, error) {
+	if strings.TrimSpace(path) == "" {
+		return "", errors.New("file storage requires a state path")
+	}
+
+	return filepath.Join(rootDir(), filepath.Clean("/"+path)), nil
+}
+
+// createExclusive creates a new file with buf as content.
+// It fails with an error satisfying os.ErrExist if the file already existed.
+func createExclusive(path string, buf []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(buf); err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+
+	return file.Close()
+}
+
+// writeAtomic writes buf to a temporary file next to path and renames it in place,
+// so readers never observe a partially written file.
+func writeAtomic(path string, buf []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -2,21 +2,29 @@ package git
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
-	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"log"
 	"sync"
+	"terraform-backend-http-proxy/storage/git/forge"
 	"terraform-backend-http-proxy/storage/internal"
 	"terraform-backend-http-proxy/storage/storagetypes"
+	"time"
 )
 
 // StorageClient implementation for Git storage type
 type StorageClient struct {
-	// sessions key is repository URL, value is everything we need to interact with it
+	// sessions key is repository URL and ref (see getSessionKey), value is everything we need to interact with it.
+	// Each ref has its own session, so work on different refs of a repository neither waits on nor checks out over each other.
 	sessions map[string]*gitSession
 
 	// sessionsMutex used for locking sessions map for adding new repositories
 	sessionsMutex sync.Mutex
+
+	// maintenance starts evicting idle sessions, fetching and collecting stale locks in the background once the first session is used
+	maintenance sync.Once
 }
 
 // NewStorageClient creates new StorageClient
@@ -42,56 +50,180 @@ func (client *StorageClient) GetLockData(data storage.ClientTypeMetadata) (*stor
 	if err != nil {
 		return nil, err
 	}
+	defer client.releaseSession(session)
 
 	session.mutex.Lock()
 	defer session.mutex.Unlock()
 
-	if err := session.fetch(locksRefSpecs); err != nil {
-		return nil, err
+	lockInfo, err := readLockInfo(session, params)
+	if errors.Is(err, storagetypes.ErrLockMissing) {
+		// In pull request mode, the state stays locked until the pull request of the last apply is merged
+		return pendingApplyLock(session, params)
+	}
+
+	return lockInfo, err
+}
+
+func (client *StorageClient) LockState(data storage.ClientTypeMetadata, rawLockData []byte) error {
+	params := data.(*requestMetadataParams)
+
+	session, err := client.getSession(params)
+	if err != nil {
+		return err
+	}
+	defer client.releaseSession(session)
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if err := prepareLockBranch(session, params, rawLockData); err != nil {
+		return err
 	}
 
 	lockBranchName := getLockBranchName(params)
 
-	// Delete any local leftovers from the past
-	if err := session.deleteBranch(lockBranchName, false); err != nil {
-		return nil, err
+	lockRef, err := getLockRef(params)
+	if err != nil {
+		return err
 	}
 
-	if err := session.checkout(lockBranchName, checkoutModeRemote); err != nil {
-		if err == plumbing.ErrReferenceNotFound {
-			return nil, storagetypes.ErrLockMissing
+	// Only one of any concurrent attempts can create the lock ref on the remote
+	if err := session.pushRef(lockBranchName, lockRef); err != nil {
+		// The lock commit never made it to the remote, don't keep referring to it
+		if err := session.deleteBranch(lockBranchName, false); err != nil {
+			return err
 		}
-		return nil, err
-	}
 
-	if err := session.pull(lockBranchName); err != nil {
-		return nil, err
+		exists, existsErr := session.remoteRefExists(lockRef)
+		if existsErr != nil {
+			return existsErr
+		}
+
+		if exists {
+			return storagetypes.ErrLockExists
+		}
+
+		return err
 	}
 
-	lock, err := session.readFile(getLockPath(params))
+	// Instances running with the other lock mode push their lock into another ref,
+	// so the lock is given up again if it was acquired there at the same time
+	return releaseIfLockedElsewhere(session, params, lockRef)
+}
+
+// releaseIfLockedElsewhere deletes the lock just pushed to the lock ref if any of the other lock refs holds a lock as well,
+// and fails with storagetypes.ErrLockExists then. Concurrent attempts might both give up, but never both hold the lock.
+func releaseIfLockedElsewhere(session *gitSession, params *requestMetadataParams, lockRef plumbing.ReferenceName) error {
+	otherLockRefs, err := getOtherLockRefs(params)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	var lockInfo storagetypes.LockInfo
-	if err := json.Unmarshal(lock, &lockInfo); err != nil {
-		return nil, err
+	for _, otherLockRef := range otherLockRefs {
+		_, reference, err := session.readLock(otherLockRef, getLockPath(params))
+		if err != nil {
+			return err
+		}
+
+		if reference == nil {
+			continue
+		}
+
+		lockBranchName := getLockBranchName(params)
+
+		pushed, err := session.repository.Reference(ref(lockBranchName, false), true)
+		if err != nil {
+			return err
+		}
+
+		if err := session.deleteRemoteRefAt(plumbing.NewHashReference(lockRef, pushed.Hash())); err != nil {
+			return err
+		}
+
+		if err := session.deleteBranch(lockBranchName, false); err != nil {
+			return err
+		}
+
+		return storagetypes.ErrLockExists
 	}
 
-	return &lockInfo, nil
+	return nil
 }
 
-func (client *StorageClient) LockState(data storage.ClientTypeMetadata, rawLockData []byte) error {
+// RenewLock replaces the lock commit with one holding the renewed lock data.
+// The remote lock ref is only replaced if it still points to the lock commit read before, holding the same lock.
+func (client *StorageClient) RenewLock(data storage.ClientTypeMetadata, rawLockData []byte) error {
 	params := data.(*requestMetadataParams)
 
 	session, err := client.getSession(params)
 	if err != nil {
 		return err
 	}
+	defer client.releaseSession(session)
 
 	session.mutex.Lock()
 	defer session.mutex.Unlock()
 
+	var renewed storagetypes.LockInfo
+	if err := json.Unmarshal(rawLockData, &renewed); err != nil {
+		return err
+	}
+
+	// The lock is renewed where it's held, which might be a ref used by earlier versions
+	current, lockInfo, err := findLock(session, params)
+	if err != nil {
+		return err
+	}
+
+	// The lock might have been released and acquired by someone else since the backend read it
+	if lockInfo.ID != renewed.ID {
+		return storagetypes.ErrLockMissing
+	}
+
+	if err := prepareLockBranch(session, params, rawLockData); err != nil {
+		return err
+	}
+
+	lockBranchName := getLockBranchName(params)
+
+	if err := session.replaceRemoteRef(lockBranchName, current); err != nil {
+		// The lock commit never made it to the remote, don't keep referring to it
+		if err := session.deleteBranch(lockBranchName, false); err != nil {
+			return err
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// prepareLockBranch points the local lock branch to a new lock commit, the way the lock mode requires.
+func prepareLockBranch(session *gitSession, params *requestMetadataParams, rawLockData []byte) error {
+	var lockInfo storagetypes.LockInfo
+	if err := json.Unmarshal(rawLockData, &lockInfo); err != nil {
+		return err
+	}
+
+	message, err := lockMessage(params, &lockInfo)
+	if err != nil {
+		return err
+	}
+
+	mode, err := lockMode()
+	if err != nil {
+		return err
+	}
+
+	if mode == lockModeRef {
+		return session.writeLockCommit(getLockBranchName(params), getLockPath(params), rawLockData, message, lockInfo.Who)
+	}
+
+	return commitLockBranch(session, params, rawLockData, message, lockInfo.Who)
+}
+
+// commitLockBranch commits the lock file on the local lock branch, created on top of the ref.
+func commitLockBranch(session *gitSession, params *requestMetadataParams, rawLockData []byte, message, who string) error {
 	if err := session.checkout(params.Ref, checkoutModeDefault); err != nil {
 		return err
 	}
@@ -118,17 +250,11 @@ func (client *StorageClient) LockState(data storage.ClientTypeMetadata, rawLockD
 		return err
 	}
 
-	if err := session.commit("Lock " + params.State); err != nil {
-		return err
-	}
-
-	if err := session.push(); err != nil {
-		return err
-	}
-
-	return nil
+	return session.commit(message, who)
 }
 
+// UnlockState releases the lock of the caller, which is only deleted if it didn't change since reading it.
+// Lock refs of earlier versions are released as well, as long as they hold the lock of the caller.
 func (client *StorageClient) UnlockState(data storage.ClientTypeMetadata) error {
 	params := data.(*requestMetadataParams)
 
@@ -136,11 +262,50 @@ func (client *StorageClient) UnlockState(data storage.ClientTypeMetadata) error
 	if err != nil {
 		return err
 	}
+	defer client.releaseSession(session)
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if err := session.deleteBranch(getLockBranchName(params), false); err != nil {
+		return err
+	}
 
-	if err := session.deleteBranch(getLockBranchName(params), true); err != nil {
+	lockRefs, err := getLockRefs(params)
+	if err != nil {
 		return err
 	}
 
+	for _, lockRef := range lockRefs {
+		lock, reference, err := session.readLock(lockRef, getLockPath(params))
+		if err != nil {
+			return err
+		}
+
+		if reference == nil {
+			continue
+		}
+
+		var lockInfo storagetypes.LockInfo
+		if err := json.Unmarshal(lock, &lockInfo); err != nil {
+			return err
+		}
+
+		// Someone else's lock, e.g. acquired after an expired lock was released
+		if lockInfo.ID != params.lockID {
+			continue
+		}
+
+		// The expired lock was renewed in the meantime
+		if params.expiredOnly && !lockInfo.Expired() {
+			continue
+		}
+
+		if err := session.deleteRemoteRefAt(reference); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -151,6 +316,7 @@ func (client *StorageClient) GetState(data storage.ClientTypeMetadata) ([]byte,
 	if err != nil {
 		return nil, err
 	}
+	defer client.releaseSession(session)
 
 	session.mutex.Lock()
 	defer session.mutex.Unlock()
@@ -159,16 +325,42 @@ func (client *StorageClient) GetState(data storage.ClientTypeMetadata) ([]byte,
 		return nil, err
 	}
 
-	if err := session.pull(params.Ref); err != nil {
+	staleReadAllowed, err := session.staleReadAllowed(params)
+	if err != nil {
 		return nil, err
 	}
 
+	// Sessions kept up to date in the background are read without fetching the state again
+	if staleReadAllowed {
+		if err := session.resetToTracking(params.Ref); err != nil {
+			return nil, err
+		}
+	} else if err := session.pull(params.Ref); err != nil {
+		return nil, err
+	}
+
+	// Updates in pull request mode only reach the ref once their pull request is merged
+	if err := checkoutPendingApply(session, params); err != nil {
+		return nil, err
+	}
+
+	verifier, err := loadSignatureVerifier()
+	if err != nil {
+		return nil, err
+	}
+
+	if verifier != nil {
+		if err := session.verifyState(params.State, verifier); err != nil {
+			return nil, err
+		}
+	}
+
 	s, err := session.readFile(params.State)
 	if err != nil {
 		return s, err
 	}
 
-	return s, nil
+	return session.decodeState(params, s)
 }
 
 func (client *StorageClient) UpdateState(data storage.ClientTypeMetadata, state []byte) error {
@@ -178,6 +370,7 @@ func (client *StorageClient) UpdateState(data storage.ClientTypeMetadata, state
 	if err != nil {
 		return err
 	}
+	defer client.releaseSession(session)
 
 	session.mutex.Lock()
 	defer session.mutex.Unlock()
@@ -186,57 +379,221 @@ func (client *StorageClient) UpdateState(data storage.ClientTypeMetadata, state
 		return err
 	}
 
-	if err := session.pull(params.Ref); err != nil {
+	pullRequestForge, err := forge.GetForge()
+	if err != nil {
 		return err
 	}
 
-	if err := session.writeFile(params.State, state); err != nil {
+	// Protected refs can't be pushed to, the state is proposed as a pull request instead
+	if pullRequestForge != nil {
+		return commitStatePullRequest(session, params, state, pullRequestForge)
+	}
+
+	lockInfo, err := currentLockInfo(session, params)
+	if err != nil {
 		return err
 	}
 
-	if err := session.add(params.State); err != nil {
+	tag, err := tagUpdates()
+	if err != nil {
 		return err
 	}
 
-	if err := session.commit("Update " + params.State); err != nil {
+	// Others might push to the same ref, in that case the state commit is re-applied on top of theirs
+	err = retryOnRemoteChange(func() error {
+		return commitState(session, params, state, lockInfo)
+	})
+	if err != nil {
 		return err
 	}
 
-	if err := session.push(); err != nil {
+	// The state is stored already, failing to tag it mustn't make Terraform believe it wasn't
+	if tag {
+		if err := session.tagState(params, lockInfo); err != nil {
+			log.Printf("could not tag %s: %s", params, err)
+		}
+	}
+
+	return nil
+}
+
+// commitState commits the state on top of the remote ref and pushes it.
+// It fails with errRemoteChanged if the push was rejected because the remote ref moved in the meantime.
+func commitState(session *gitSession, params *requestMetadataParams, state []byte, lockInfo *storagetypes.LockInfo) error {
+	base, err := session.resetToRemote(params.Ref)
+	if err != nil {
+		return err
+	}
+
+	if err := writeStateCommit(session, params, state, lockInfo); err != nil {
+		return err
+	}
+
+	if err := session.pushRef(params.Ref, ref(params.Ref, false)); err != nil {
+		current, currentErr := session.remoteRef(ref(params.Ref, false))
+		if currentErr != nil {
+			return currentErr
+		}
+
+		if current != nil && current.Hash() != base {
+			return fmt.Errorf("%w: %s", errRemoteChanged, err)
+		}
+
 		return err
 	}
 
 	return nil
 }
 
+// writeStateCommit writes the state on top of the current branch and commits it.
+// The lockInfo is what the state is updated under, it might be nil if the state isn't locked.
+func writeStateCommit(session *gitSession, params *requestMetadataParams, state []byte, lockInfo *storagetypes.LockInfo) error {
+	message, err := updateMessage(params, lockInfo)
+	if err != nil {
+		return err
+	}
+
+	message = withStateTrailers(message, params.update)
+
+	who, err := lockHolder(lockInfo)
+	if err != nil {
+		return err
+	}
+
+	contents, err := session.encodeState(params, state)
+	if err != nil {
+		return err
+	}
+
+	if err := session.writeFile(params.State, contents); err != nil {
+		return err
+	}
+
+	if err := session.add(params.State); err != nil {
+		return err
+	}
+
+	return session.commit(message, who)
+}
+
+// readLockInfo reads the lock currently held on the remote repository.
+// The session must be locked by the caller.
+func readLockInfo(session *gitSession, params *requestMetadataParams) (*storagetypes.LockInfo, error) {
+	_, lockInfo, err := findLock(session, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return lockInfo, nil
+}
+
+// findLock reads the lock currently held on the remote repository, with the ref it's held in as fetched.
+// Locks might still be held in the refs used by earlier versions or the other lock mode, see getOtherLockRefs.
+// The session must be locked by the caller.
+func findLock(session *gitSession, params *requestMetadataParams) (*plumbing.Reference, *storagetypes.LockInfo, error) {
+	lockRefs, err := getLockRefs(params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, lockRef := range lockRefs {
+		lock, reference, err := session.readLock(lockRef, getLockPath(params))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if reference == nil {
+			continue
+		}
+
+		var lockInfo storagetypes.LockInfo
+		if err := json.Unmarshal(lock, &lockInfo); err != nil {
+			return nil, nil, err
+		}
+
+		return reference, &lockInfo, nil
+	}
+
+	return nil, nil, storagetypes.ErrLockMissing
+}
+
+// currentLockInfo reads the lock currently held, it returns nil if the state isn't locked.
+// The session must be locked by the caller.
+func currentLockInfo(session *gitSession, params *requestMetadataParams) (*storagetypes.LockInfo, error) {
+	lockInfo, err := readLockInfo(session, params)
+	if err != nil {
+		if errors.Is(err, storagetypes.ErrLockMissing) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return lockInfo, nil
+}
+
+// lockHolder returns who holds the lock, if commits are to be authored by them.
+func lockHolder(lockInfo *storagetypes.LockInfo) (string, error) {
+	fromLock, err := authorFromLock()
+	if err != nil || !fromLock || lockInfo == nil {
+		return "", err
+	}
+
+	return lockInfo.Who, nil
+}
+
+// getSession returns the session of the repository, creating it if there's none yet.
+// The session is kept from being evicted until it's released with releaseSession.
 func (client *StorageClient) getSession(data *requestMetadataParams) (*gitSession, error) {
+	client.maintenance.Do(func() {
+		client.startSessionMaintenance()
+		client.startLockGC()
+	})
+
 	client.sessionsMutex.Lock()
 	defer client.sessionsMutex.Unlock()
 
-	session, ok := client.sessions[data.Repository]
+	key := getSessionKey(data)
+
+	session, ok := client.sessions[key]
 	if !ok {
+		if err := client.evictForNewSession(); err != nil {
+			return nil, err
+		}
+
 		s, err := newStorageSession(data)
 		if err != nil {
 			return nil, err
 		}
 
-		client.sessions[data.Repository] = s
+		client.sessions[key] = s
 		session = s
 	}
 
+	session.users++
+	session.lastUsed = time.Now()
+
 	return session, nil
 }
 
+// releaseSession marks the session as no longer used by the caller.
+func (client *StorageClient) releaseSession(session *gitSession) {
+	client.sessionsMutex.Lock()
+	defer client.sessionsMutex.Unlock()
+
+	session.users--
+	session.lastUsed = time.Now()
+}
+
+// getSessionKey identifies the session of the repository ref
+func getSessionKey(params *requestMetadataParams) string {
+	return params.Repository + "#" + params.Ref
+}
+
 func getLockPath(params *requestMetadataParams) string {
 	return params.State + ".lock"
 }
 
+// getLockBranchName is the local branch lock commits are prepared on before pushing them to the lock ref
 func getLockBranchName(params *requestMetadataParams) string {
 	return "lock/" + params.State
 }
-
-var (
-	locksRefSpecs = []config.RefSpec{
-		"refs/heads/locks/*:refs/remotes/origin/locks/*",
-	}
-)
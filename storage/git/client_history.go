@@ -0,0 +1,233 @@
+package git
+
+import (
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"os"
+	"strconv"
+	"strings"
+	"terraform-backend-http-proxy/storage/internal"
+	"terraform-backend-http-proxy/storage/storagetypes"
+)
+
+func (client *StorageClient) GetStateVersions(data storage.ClientTypeMetadata) ([]storagetypes.StateVersion, error) {
+	params := data.(*requestMetadataParams)
+
+	session, err := client.getSession(params)
+	if err != nil {
+		return nil, err
+	}
+	defer client.releaseSession(session)
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if err := session.checkout(params.Ref, checkoutModeDefault); err != nil {
+		return nil, err
+	}
+
+	if err := session.pull(params.Ref); err != nil {
+		return nil, err
+	}
+
+	commits, err := session.stateLog(params.State)
+	if err != nil {
+		return nil, err
+	}
+	defer commits.Close()
+
+	var versions []storagetypes.StateVersion
+	err = commits.ForEach(func(commit *object.Commit) error {
+		version := storagetypes.StateVersion{
+			ID:      commit.Hash.String(),
+			Created: commit.Author.When,
+			Author:  fmt.Sprintf("%s <%s>", commit.Author.Name, commit.Author.Email),
+		}
+
+		// Versions committed by earlier versions have no trailers, their state is read for the caller instead
+		if version.Serial, version.Lineage = stateTrailers(commit.Message); version.Lineage == "" {
+			version.State = session.readStateVersion(params, commit)
+		}
+
+		versions = append(versions, version)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// GetStateVersion reads the state at the given version, which must be a commit in the log of the state at the ref.
+// The version is verified the same way GetState verifies the current state.
+func (client *StorageClient) GetStateVersion(data storage.ClientTypeMetadata, version string) ([]byte, error) {
+	params := data.(*requestMetadataParams)
+
+	session, err := client.getSession(params)
+	if err != nil {
+		return nil, err
+	}
+	defer client.releaseSession(session)
+
+	if !plumbing.IsHash(version) {
+		return nil, fmt.Errorf("version %q is not a commit SHA: %w", version, os.ErrNotExist)
+	}
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if err := session.checkout(params.Ref, checkoutModeDefault); err != nil {
+		return nil, err
+	}
+
+	// Versions are immutable, so we only need to pull if we don't know the version yet
+	commit, err := session.stateVersion(params.State, plumbing.NewHash(version))
+	if err != nil {
+		return nil, err
+	}
+
+	if commit == nil {
+		if err := session.pull(params.Ref); err != nil {
+			return nil, err
+		}
+
+		if commit, err = session.stateVersion(params.State, plumbing.NewHash(version)); err != nil {
+			return nil, err
+		}
+	}
+
+	if commit == nil {
+		return nil, fmt.Errorf("version %s of %s: %w", version, params.State, os.ErrNotExist)
+	}
+
+	verifier, err := loadSignatureVerifier()
+	if err != nil {
+		return nil, err
+	}
+
+	if verifier != nil {
+		if err := verifier.verify(commit); err != nil {
+			return nil, fmt.Errorf("%w: commit %s: %s", storagetypes.ErrUntrustedState, commit.Hash, err)
+		}
+	}
+
+	file, err := commit.File(params.State)
+	if err != nil {
+		if err == object.ErrFileNotFound {
+			return nil, fmt.Errorf("version %s of %s: %w", version, params.State, os.ErrNotExist)
+		}
+		return nil, err
+	}
+
+	contents, err := file.Contents()
+	if err != nil {
+		return nil, err
+	}
+
+	return session.decodeState(params, []byte(contents))
+}
+
+// readStateVersion reads the state as committed, it's nil if it can't be read.
+func (gitSession *gitSession) readStateVersion(params *requestMetadataParams, commit *object.Commit) []byte {
+	file, err := commit.File(params.State)
+	if err != nil {
+		return nil
+	}
+
+	contents, err := file.Contents()
+	if err != nil {
+		return nil
+	}
+
+	state, err := gitSession.decodeState(params, []byte(contents))
+	if err != nil {
+		return nil
+	}
+
+	return state
+}
+
+// stateVersion finds the version in the log of the state at HEAD, it's nil if the commit isn't a version of the state.
+func (gitSession *gitSession) stateVersion(path string, version plumbing.Hash) (*object.Commit, error) {
+	commits, err := gitSession.stateLog(path)
+	if err != nil {
+		return nil, err
+	}
+	defer commits.Close()
+
+	var found *object.Commit
+	err = commits.ForEach(func(commit *object.Commit) error {
+		if commit.Hash != version {
+			return nil
+		}
+
+		found = commit
+		return storer.ErrStop
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return found, nil
+}
+
+// stateLog iterates the commits touching the state at HEAD, newest first.
+func (gitSession *gitSession) stateLog(path string) (object.CommitIter, error) {
+	head, err := gitSession.repository.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	return gitSession.repository.Log(&git.LogOptions{
+		From: head.Hash(),
+		PathFilter: func(p string) bool {
+			return p == path
+		},
+	})
+}
+
+const (
+	// serialTrailer and lineageTrailer are the commit message trailers the serial and lineage of the state are recorded in.
+	// Versions can be listed with them without reading, and decrypting, every single version.
+	serialTrailer  = "Terraform-Serial"
+	lineageTrailer = "Terraform-Lineage"
+)
+
+// withStateTrailers adds the serial and lineage of the state to the commit message, if they're known.
+func withStateTrailers(message string, update *storagetypes.StateUpdate) string {
+	if update == nil || update.Serial == nil {
+		return message
+	}
+
+	return strings.TrimRight(message, "\n") + "\n\n" +
+		serialTrailer + ": " + strconv.FormatUint(*update.Serial, 10) + "\n" +
+		lineageTrailer + ": " + update.Lineage + "\n"
+}
+
+// stateTrailers reads the serial and lineage added by withStateTrailers, the lineage is empty if there were none.
+func stateTrailers(message string) (uint64, string) {
+	var serial uint64
+	var lineage string
+
+	for _, line := range strings.Split(message, "\n") {
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case serialTrailer:
+			if parsed, err := strconv.ParseUint(value, 10, 64); err == nil {
+				serial = parsed
+			}
+		case lineageTrailer:
+			lineage = value
+		}
+	}
+
+	return serial, lineage
+}
@@ -0,0 +1,160 @@
+package forge
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const requestTimeout = time.Minute
+
+// Forge opens and merges pull requests on the platform hosting the repository.
+type Forge interface {
+	// OpenPullRequest opens a pull request merging the head branch into the base branch.
+	OpenPullRequest(request PullRequest) (*PullRequestResult, error)
+
+	// MergePullRequest merges a pull request opened by OpenPullRequest,
+	// once the forge determined that it can be merged.
+	MergePullRequest(repository string, result *PullRequestResult) error
+}
+
+// PullRequest describes a pull request (merge request on GitLab) to open.
+type PullRequest struct {
+	// Repository is the path of the repository on the forge, e.g. org/repo
+	Repository string
+
+	// Head is the branch with the changes
+	Head string
+
+	// Base is the branch the changes should be merged into
+	Base string
+
+	Title, Body string
+}
+
+// PullRequestResult identifies an opened pull request.
+type PullRequestResult struct {
+	// Number is the number of the pull request within the repository (iid on GitLab)
+	Number int
+
+	// URL is the web URL of the pull request
+	URL string
+}
+
+// errNotMergeable is returned if the forge determined that the pull request can't be merged, e.g. due to conflicts.
+var errNotMergeable = errors.New("pull request can't be merged")
+
+// Forges determine whether a pull request can be merged in the background after opening it.
+// Its mergeability is checked up to mergeableChecks times, mergeableCheckInterval apart, before giving up on merging it.
+var (
+	mergeableChecks        = 10
+	mergeableCheckInterval = time.Second
+)
+
+// forgeConstructor creates a forge client for the API base URL, empty meaning the default for the forge.
+type forgeConstructor func(baseURL, token string) (Forge, error)
+
+var forges = make(map[string]forgeConstructor)
+
+func init() {
+	forges["github"] = newGitHub
+	forges["gitlab"] = newGitLab
+	forges["gitea"] = newGitea
+}
+
+// GetForge gets the forge based on the environment variables set before launching the tool.
+// It returns nil if pull request mode is not enabled.
+func GetForge() (Forge, error) {
+	name, enabled := os.LookupEnv("TF_BACKEND_HTTP_GIT_PULL_REQUEST_FORGE")
+	if !enabled {
+		return nil, nil
+	}
+
+	constructor, ok := forges[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown forge %q", name)
+	}
+
+	token, ok := os.LookupEnv("TF_BACKEND_HTTP_GIT_FORGE_TOKEN")
+	if !ok {
+		token = os.Getenv("GITHUB_TOKEN")
+	}
+
+	return constructor(strings.TrimSuffix(os.Getenv("TF_BACKEND_HTTP_GIT_FORGE_URL"), "/"), token)
+}
+
+// apiClient is shared by the forge implementations for calling their JSON APIs.
+type apiClient struct {
+	baseURL string
+
+	// authorize sets the authentication headers of the forge
+	authorize func(*http.Request)
+}
+
+// call sends the payload as JSON, if not nil, and decodes the JSON response into result, if not nil.
+func (client *apiClient) call(method, path string, payload, result interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, client.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	client.authorize(req)
+
+	httpClient := http.Client{
+		Timeout: requestTimeout,
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		message, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("%s %s: %s: %s", method, path, res.Status, message)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(result)
+}
+
+// waitMergeable calls check until it reports that the pull request can be merged.
+// The check fails with errNotMergeable if the forge determined that it can't.
+func waitMergeable(check func() (bool, error)) error {
+	for i := 0; i < mergeableChecks; i++ {
+		if i > 0 {
+			time.Sleep(mergeableCheckInterval)
+		}
+
+		mergeable, err := check()
+		if err != nil || mergeable {
+			return err
+		}
+	}
+
+	return fmt.Errorf("%w: still not mergeable after %d checks", errNotMergeable, mergeableChecks)
+}
@@ -0,0 +1,175 @@
+package forge
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// forgeServer is a stand-in for the API of a forge, answering requests with canned responses.
+type forgeServer struct {
+	*httptest.Server
+
+	mutex sync.Mutex
+
+	// responses are the bodies answered by method and escaped path, e.g. "GET /repos/org/repo/pulls/1".
+	// They're answered in order, the last one repeatedly.
+	responses map[string][]string
+
+	// requests are the requests received, by method and escaped path as well
+	requests []forgeRequest
+}
+
+type forgeRequest struct {
+	route   string
+	header  http.Header
+	payload map[string]interface{}
+}
+
+func newForgeServer(t *testing.T, responses map[string][]string) *forgeServer {
+	server := &forgeServer{
+		responses: responses,
+	}
+
+	server.Server = httptest.NewServer(http.HandlerFunc(server.handle))
+	t.Cleanup(server.Close)
+
+	fastMergeableChecks(t)
+
+	return server
+}
+
+// fastMergeableChecks checks mergeability without waiting in between, for the duration of the test.
+func fastMergeableChecks(t *testing.T) {
+	checks, interval := mergeableChecks, mergeableCheckInterval
+	mergeableChecks, mergeableCheckInterval = 3, time.Millisecond
+
+	t.Cleanup(func() {
+		mergeableChecks, mergeableCheckInterval = checks, interval
+	})
+}
+
+func (server *forgeServer) handle(w http.ResponseWriter, r *http.Request) {
+	route := r.Method + " " + r.URL.EscapedPath()
+
+	var payload map[string]interface{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.requests = append(server.requests, forgeRequest{
+		route:   route,
+		header:  r.Header,
+		payload: payload,
+	})
+
+	responses, ok := server.responses[route]
+	if !ok {
+		http.Error(w, "unexpected request "+route, http.StatusNotFound)
+		return
+	}
+
+	response := responses[0]
+	if len(responses) > 1 {
+		server.responses[route] = responses[1:]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(response))
+}
+
+// routes are the routes of the requests received, in order.
+func (server *forgeServer) routes() []string {
+	routes := make([]string, 0, len(server.requests))
+	for _, request := range server.requests {
+		routes = append(routes, request.route)
+	}
+
+	return routes
+}
+
+func assertRoutes(t *testing.T, server *forgeServer, want ...string) {
+	t.Helper()
+
+	routes := server.routes()
+	if len(routes) != len(want) {
+		t.Fatalf("requests = %q, want %q", routes, want)
+	}
+
+	for i := range want {
+		if routes[i] != want[i] {
+			t.Fatalf("requests = %q, want %q", routes, want)
+		}
+	}
+}
+
+func assertPayload(t *testing.T, request forgeRequest, want map[string]string) {
+	t.Helper()
+
+	for key, value := range want {
+		if request.payload[key] != value {
+			t.Errorf("%s: %s = %v, want %q", request.route, key, request.payload[key], value)
+		}
+	}
+}
+
+var testPullRequest = PullRequest{
+	Repository: "org/repo",
+	Head:       "tf-apply/prod.tfstate/1",
+	Base:       "main",
+	Title:      "Update prod.tfstate",
+	Body:       "Terraform state update",
+}
+
+func TestGetForge(t *testing.T) {
+	t.Setenv("TF_BACKEND_HTTP_GIT_PULL_REQUEST_FORGE", "gitlab")
+	t.Setenv("TF_BACKEND_HTTP_GIT_FORGE_URL", "https://gitlab.example.com/api/v4/")
+	t.Setenv("TF_BACKEND_HTTP_GIT_FORGE_TOKEN", "token")
+
+	forge, err := GetForge()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gitLab, ok := forge.(*gitLab)
+	if !ok {
+		t.Fatalf("forge = %T, want *gitLab", forge)
+	}
+
+	if gitLab.api.baseURL != "https://gitlab.example.com/api/v4" {
+		t.Errorf("base URL = %q", gitLab.api.baseURL)
+	}
+
+	t.Setenv("TF_BACKEND_HTTP_GIT_PULL_REQUEST_FORGE", "bitbucket")
+	if _, err := GetForge(); err == nil {
+		t.Error("got an unknown forge")
+	}
+}
+
+func TestWaitMergeable(t *testing.T) {
+	fastMergeableChecks(t)
+
+	checks := 0
+	err := waitMergeable(func() (bool, error) {
+		checks++
+		return false, nil
+	})
+
+	if !errors.Is(err, errNotMergeable) {
+		t.Errorf("err = %v, want errNotMergeable", err)
+	}
+
+	if checks != mergeableChecks {
+		t.Errorf("checked %d times, want %d", checks, mergeableChecks)
+	}
+}
@@ -0,0 +1,77 @@
+package forge
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// gitea opens pull requests through the Gitea REST API.
+type gitea struct {
+	api *apiClient
+}
+
+func newGitea(baseURL, token string) (Forge, error) {
+	// Gitea is always self-hosted, so there is no default to fall back to
+	if baseURL == "" {
+		return nil, errors.New("gitea requires TF_BACKEND_HTTP_GIT_FORGE_URL to be set")
+	}
+
+	return &gitea{
+		api: &apiClient{
+			baseURL: baseURL,
+			authorize: func(req *http.Request) {
+				req.Header.Set("Authorization", "token "+token)
+			},
+		},
+	}, nil
+}
+
+func (forge *gitea) OpenPullRequest(request PullRequest) (*PullRequestResult, error) {
+	payload := map[string]string{
+		"title": request.Title,
+		"body":  request.Body,
+		"head":  request.Head,
+		"base":  request.Base,
+	}
+
+	var pull struct {
+		Number  int    `json:"number"`
+		HTMLURL string `json:"html_url"`
+	}
+
+	if err := forge.api.call(http.MethodPost, fmt.Sprintf("/repos/%s/pulls", request.Repository), payload, &pull); err != nil {
+		return nil, err
+	}
+
+	return &PullRequestResult{
+		Number: pull.Number,
+		URL:    pull.HTMLURL,
+	}, nil
+}
+
+func (forge *gitea) MergePullRequest(repository string, result *PullRequestResult) error {
+	path := fmt.Sprintf("/repos/%s/pulls/%d", repository, result.Number)
+
+	// Gitea reports pull requests as not mergeable while it's still checking them
+	err := waitMergeable(func() (bool, error) {
+		var pull struct {
+			Mergeable bool `json:"mergeable"`
+		}
+
+		if err := forge.api.call(http.MethodGet, path, nil, &pull); err != nil {
+			return false, err
+		}
+
+		return pull.Mergeable, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]string{
+		"Do": "merge",
+	}
+
+	return forge.api.call(http.MethodPost, path+"/merge", payload, nil)
+}
@@ -0,0 +1,91 @@
+package forge
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGiteaOpenPullRequest(t *testing.T) {
+	server := newForgeServer(t, map[string][]string{
+		"POST /repos/org/repo/pulls": {`{"number": 5, "html_url": "https://gitea.example.com/org/repo/pulls/5"}`},
+	})
+
+	forge, err := newGitea(server.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := forge.OpenPullRequest(testPullRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Number != 5 || result.URL != "https://gitea.example.com/org/repo/pulls/5" {
+		t.Errorf("result = %+v", result)
+	}
+
+	assertRoutes(t, server, "POST /repos/org/repo/pulls")
+	assertPayload(t, server.requests[0], map[string]string{
+		"title": testPullRequest.Title,
+		"body":  testPullRequest.Body,
+		"head":  testPullRequest.Head,
+		"base":  testPullRequest.Base,
+	})
+
+	if authorization := server.requests[0].header.Get("Authorization"); authorization != "token token" {
+		t.Errorf("Authorization = %q", authorization)
+	}
+}
+
+func TestGiteaRequiresURL(t *testing.T) {
+	if _, err := newGitea("", "token"); err == nil {
+		t.Error("created a Gitea forge without URL")
+	}
+}
+
+func TestGiteaMergePullRequest(t *testing.T) {
+	server := newForgeServer(t, map[string][]string{
+		"GET /repos/org/repo/pulls/5": {
+			`{"mergeable": false}`,
+			`{"mergeable": true}`,
+		},
+		"POST /repos/org/repo/pulls/5/merge": {``},
+	})
+
+	forge, err := newGitea(server.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := forge.MergePullRequest("org/repo", &PullRequestResult{Number: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	assertRoutes(t, server,
+		"GET /repos/org/repo/pulls/5",
+		"GET /repos/org/repo/pulls/5",
+		"POST /repos/org/repo/pulls/5/merge",
+	)
+	assertPayload(t, server.requests[2], map[string]string{
+		"Do": "merge",
+	})
+}
+
+func TestGiteaMergePullRequestNeverMergeable(t *testing.T) {
+	server := newForgeServer(t, map[string][]string{
+		"GET /repos/org/repo/pulls/5": {`{"mergeable": false}`},
+	})
+
+	forge, err := newGitea(server.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := forge.MergePullRequest("org/repo", &PullRequestResult{Number: 5}); !errors.Is(err, errNotMergeable) {
+		t.Errorf("err = %v, want errNotMergeable", err)
+	}
+
+	if checks := len(server.requests); checks != mergeableChecks {
+		t.Errorf("checked %d times, want %d", checks, mergeableChecks)
+	}
+}
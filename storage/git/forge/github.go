@@ -0,0 +1,82 @@
+package forge
+
+import (
+	"fmt"
+	"net/http"
+)
+
+const defaultGitHubURL = "https://api.github.com"
+
+// gitHub opens pull requests through the GitHub REST API.
+type gitHub struct {
+	api *apiClient
+}
+
+func newGitHub(baseURL, token string) (Forge, error) {
+	if baseURL == "" {
+		baseURL = defaultGitHubURL
+	}
+
+	return &gitHub{
+		api: &apiClient{
+			baseURL: baseURL,
+			authorize: func(req *http.Request) {
+				req.Header.Set("Authorization", "Bearer "+token)
+			},
+		},
+	}, nil
+}
+
+func (forge *gitHub) OpenPullRequest(request PullRequest) (*PullRequestResult, error) {
+	payload := map[string]string{
+		"title": request.Title,
+		"body":  request.Body,
+		"head":  request.Head,
+		"base":  request.Base,
+	}
+
+	var pull struct {
+		Number  int    `json:"number"`
+		HTMLURL string `json:"html_url"`
+	}
+
+	if err := forge.api.call(http.MethodPost, fmt.Sprintf("/repos/%s/pulls", request.Repository), payload, &pull); err != nil {
+		return nil, err
+	}
+
+	return &PullRequestResult{
+		Number: pull.Number,
+		URL:    pull.HTMLURL,
+	}, nil
+}
+
+func (forge *gitHub) MergePullRequest(repository string, result *PullRequestResult) error {
+	path := fmt.Sprintf("/repos/%s/pulls/%d", repository, result.Number)
+
+	// mergeable is null until GitHub determined it
+	err := waitMergeable(func() (bool, error) {
+		var pull struct {
+			Mergeable      *bool  `json:"mergeable"`
+			MergeableState string `json:"mergeable_state"`
+		}
+
+		if err := forge.api.call(http.MethodGet, path, nil, &pull); err != nil {
+			return false, err
+		}
+
+		if pull.Mergeable != nil && !*pull.Mergeable {
+			return false, fmt.Errorf("%w: %s", errNotMergeable, pull.MergeableState)
+		}
+
+		return pull.Mergeable != nil, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]string{
+		"merge_method": "merge",
+	}
+
+	return forge.api.call(http.MethodPut, path+"/merge", payload, nil)
+}
@@ -0,0 +1,83 @@
+package forge
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGitHubOpenPullRequest(t *testing.T) {
+	server := newForgeServer(t, map[string][]string{
+		"POST /repos/org/repo/pulls": {`{"number": 7, "html_url": "https://github.com/org/repo/pull/7"}`},
+	})
+
+	forge, err := newGitHub(server.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := forge.OpenPullRequest(testPullRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Number != 7 || result.URL != "https://github.com/org/repo/pull/7" {
+		t.Errorf("result = %+v", result)
+	}
+
+	assertRoutes(t, server, "POST /repos/org/repo/pulls")
+	assertPayload(t, server.requests[0], map[string]string{
+		"title": testPullRequest.Title,
+		"body":  testPullRequest.Body,
+		"head":  testPullRequest.Head,
+		"base":  testPullRequest.Base,
+	})
+
+	if authorization := server.requests[0].header.Get("Authorization"); authorization != "Bearer token" {
+		t.Errorf("Authorization = %q", authorization)
+	}
+}
+
+func TestGitHubMergePullRequest(t *testing.T) {
+	server := newForgeServer(t, map[string][]string{
+		"GET /repos/org/repo/pulls/7": {
+			`{"mergeable": null, "mergeable_state": "unknown"}`,
+			`{"mergeable": true, "mergeable_state": "clean"}`,
+		},
+		"PUT /repos/org/repo/pulls/7/merge": {`{"merged": true}`},
+	})
+
+	forge, err := newGitHub(server.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := forge.MergePullRequest("org/repo", &PullRequestResult{Number: 7}); err != nil {
+		t.Fatal(err)
+	}
+
+	assertRoutes(t, server,
+		"GET /repos/org/repo/pulls/7",
+		"GET /repos/org/repo/pulls/7",
+		"PUT /repos/org/repo/pulls/7/merge",
+	)
+	assertPayload(t, server.requests[2], map[string]string{
+		"merge_method": "merge",
+	})
+}
+
+func TestGitHubMergePullRequestConflict(t *testing.T) {
+	server := newForgeServer(t, map[string][]string{
+		"GET /repos/org/repo/pulls/7": {`{"mergeable": false, "mergeable_state": "dirty"}`},
+	})
+
+	forge, err := newGitHub(server.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := forge.MergePullRequest("org/repo", &PullRequestResult{Number: 7}); !errors.Is(err, errNotMergeable) {
+		t.Errorf("err = %v, want errNotMergeable", err)
+	}
+
+	assertRoutes(t, server, "GET /repos/org/repo/pulls/7")
+}
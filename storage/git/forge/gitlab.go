@@ -0,0 +1,83 @@
+package forge
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const defaultGitLabURL = "https://gitlab.com/api/v4"
+
+// gitLab opens merge requests through the GitLab REST API.
+type gitLab struct {
+	api *apiClient
+}
+
+func newGitLab(baseURL, token string) (Forge, error) {
+	if baseURL == "" {
+		baseURL = defaultGitLabURL
+	}
+
+	return &gitLab{
+		api: &apiClient{
+			baseURL: baseURL,
+			authorize: func(req *http.Request) {
+				req.Header.Set("PRIVATE-TOKEN", token)
+			},
+		},
+	}, nil
+}
+
+func (forge *gitLab) OpenPullRequest(request PullRequest) (*PullRequestResult, error) {
+	payload := map[string]string{
+		"title":         request.Title,
+		"description":   request.Body,
+		"source_branch": request.Head,
+		"target_branch": request.Base,
+	}
+
+	var mergeRequest struct {
+		IID    int    `json:"iid"`
+		WebURL string `json:"web_url"`
+	}
+
+	if err := forge.api.call(http.MethodPost, fmt.Sprintf("/projects/%s/merge_requests", projectID(request.Repository)), payload, &mergeRequest); err != nil {
+		return nil, err
+	}
+
+	return &PullRequestResult{
+		Number: mergeRequest.IID,
+		URL:    mergeRequest.WebURL,
+	}, nil
+}
+
+func (forge *gitLab) MergePullRequest(repository string, result *PullRequestResult) error {
+	path := fmt.Sprintf("/projects/%s/merge_requests/%d", projectID(repository), result.Number)
+
+	// merge_status is unchecked or checking until GitLab determined it
+	err := waitMergeable(func() (bool, error) {
+		var mergeRequest struct {
+			MergeStatus string `json:"merge_status"`
+		}
+
+		if err := forge.api.call(http.MethodGet, path, nil, &mergeRequest); err != nil {
+			return false, err
+		}
+
+		if mergeRequest.MergeStatus == "cannot_be_merged" {
+			return false, fmt.Errorf("%w: %s", errNotMergeable, mergeRequest.MergeStatus)
+		}
+
+		return mergeRequest.MergeStatus == "can_be_merged", nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return forge.api.call(http.MethodPut, path+"/merge", struct{}{}, nil)
+}
+
+// projectID is the URL-encoded path GitLab accepts in place of the numeric project id.
+func projectID(repository string) string {
+	return url.PathEscape(repository)
+}
@@ -0,0 +1,82 @@
+package forge
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGitLabOpenPullRequest(t *testing.T) {
+	server := newForgeServer(t, map[string][]string{
+		"POST /projects/org%2Frepo/merge_requests": {`{"iid": 3, "web_url": "https://gitlab.com/org/repo/-/merge_requests/3"}`},
+	})
+
+	forge, err := newGitLab(server.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := forge.OpenPullRequest(testPullRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Number != 3 || result.URL != "https://gitlab.com/org/repo/-/merge_requests/3" {
+		t.Errorf("result = %+v", result)
+	}
+
+	assertRoutes(t, server, "POST /projects/org%2Frepo/merge_requests")
+	assertPayload(t, server.requests[0], map[string]string{
+		"title":         testPullRequest.Title,
+		"description":   testPullRequest.Body,
+		"source_branch": testPullRequest.Head,
+		"target_branch": testPullRequest.Base,
+	})
+
+	if token := server.requests[0].header.Get("PRIVATE-TOKEN"); token != "token" {
+		t.Errorf("PRIVATE-TOKEN = %q", token)
+	}
+}
+
+func TestGitLabMergePullRequest(t *testing.T) {
+	server := newForgeServer(t, map[string][]string{
+		"GET /projects/org%2Frepo/merge_requests/3": {
+			`{"merge_status": "unchecked"}`,
+			`{"merge_status": "checking"}`,
+			`{"merge_status": "can_be_merged"}`,
+		},
+		"PUT /projects/org%2Frepo/merge_requests/3/merge": {`{"state": "merged"}`},
+	})
+
+	forge, err := newGitLab(server.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := forge.MergePullRequest("org/repo", &PullRequestResult{Number: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	assertRoutes(t, server,
+		"GET /projects/org%2Frepo/merge_requests/3",
+		"GET /projects/org%2Frepo/merge_requests/3",
+		"GET /projects/org%2Frepo/merge_requests/3",
+		"PUT /projects/org%2Frepo/merge_requests/3/merge",
+	)
+}
+
+func TestGitLabMergePullRequestConflict(t *testing.T) {
+	server := newForgeServer(t, map[string][]string{
+		"GET /projects/org%2Frepo/merge_requests/3": {`{"merge_status": "cannot_be_merged"}`},
+	})
+
+	forge, err := newGitLab(server.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := forge.MergePullRequest("org/repo", &PullRequestResult{Number: 3}); !errors.Is(err, errNotMergeable) {
+		t.Errorf("err = %v, want errNotMergeable", err)
+	}
+
+	assertRoutes(t, server, "GET /projects/org%2Frepo/merge_requests/3")
+}
@@ -2,6 +2,7 @@ package git
 
 import (
 	"errors"
+	"fmt"
 	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-billy/v5/memfs"
 	"github.com/go-git/go-git/v5"
@@ -11,14 +12,17 @@ import (
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/storage"
 	"github.com/go-git/go-git/v5/storage/memory"
-	"os/exec"
-	"strings"
+	"os"
+	"strconv"
 	"sync"
 	"time"
 )
 
 // gitSession represents a particular Git repository
 type gitSession struct {
+	// url of the remote repository
+	url string
+
 	// auth credentials for remote operations
 	auth transport.AuthMethod
 
@@ -31,14 +35,33 @@ type gitSession struct {
 	// repository represents a git repository
 	repository *git.Repository
 
+	// depth limits the history fetched from remote, 0 means full history
+	depth int
+
+	// users is the number of requests currently using the session, it's guarded by StorageClient.sessionsMutex.
+	// Sessions in use are never evicted.
+	users int
+
+	// lastUsed is when the session was last acquired or released, it's guarded by StorageClient.sessionsMutex.
+	lastUsed time.Time
+
+	// fetched is when the remote was last fetched in the background, it's guarded by mutex.
+	fetched time.Time
+
 	// mutex since we can't be doing parallel complex operations on a single working tree, involving checkout branches etc.,
 	// we need to use the lock and make sure only one tread is "connected" (interacts with the repository using local working tree).
 	mutex sync.Mutex
 }
 
-// newStorageSession makes a fresh clone to in-memory FS and saves everything to the StorageSession
+// newStorageSession makes a fresh clone to in-memory FS and saves everything to the StorageSession.
+// If TF_BACKEND_HTTP_GIT_CACHE_DIR was set, the clone is kept on disk within that directory instead.
 func newStorageSession(params *requestMetadataParams) (*gitSession, error) {
+	if cacheDir, ok := os.LookupEnv("TF_BACKEND_HTTP_GIT_CACHE_DIR"); ok {
+		return newCachedStorageSession(params, cacheDir)
+	}
+
 	storageSession := &gitSession{
+		url:    params.Repository,
 		storer: memory.NewStorage(),
 		fs:     memfs.New(),
 		mutex:  sync.Mutex{},
@@ -60,11 +83,25 @@ func (gitSession *gitSession) clone(params *requestMetadataParams) error {
 
 	gitSession.auth = auth
 
+	depth, err := cloneDepth(params)
+	if err != nil {
+		return err
+	}
+
+	gitSession.depth = depth
+
+	singleBranch, err := cloneSingleBranch()
+	if err != nil {
+		return err
+	}
+
 	refer := ref(params.Ref, false)
 	cloneOptions := &git.CloneOptions{
 		URL:           params.Repository,
 		Auth:          auth,
 		ReferenceName: refer,
+		SingleBranch:  singleBranch,
+		Depth:         depth,
 	}
 
 	repository, err := git.Clone(gitSession.storer, gitSession.fs, cloneOptions)
@@ -77,6 +114,38 @@ func (gitSession *gitSession) clone(params *requestMetadataParams) error {
 	return nil
 }
 
+// cloneDepth returns the clone depth configured with TF_BACKEND_HTTP_GIT_CLONE_DEPTH.
+// Shallow clones only contain the given number of commits, 0 means full history.
+// Local repositories are always cloned in full, since shallow clones aren't supported for them.
+func cloneDepth(params *requestMetadataParams) (int, error) {
+	depth, ok := os.LookupEnv("TF_BACKEND_HTTP_GIT_CLONE_DEPTH")
+	if !ok || isLocalRepository(params.Repository) {
+		return 0, nil
+	}
+
+	d, err := strconv.Atoi(depth)
+	if err != nil {
+		return 0, err
+	}
+
+	if d < 0 {
+		return 0, fmt.Errorf("invalid clone depth %d", d)
+	}
+
+	return d, nil
+}
+
+// cloneSingleBranch returns if only the requested ref should be cloned, configured with TF_BACKEND_HTTP_GIT_SINGLE_BRANCH.
+// Lock branches are fetched on demand regardless.
+func cloneSingleBranch() (bool, error) {
+	singleBranch, ok := os.LookupEnv("TF_BACKEND_HTTP_GIT_SINGLE_BRANCH")
+	if !ok {
+		return false, nil
+	}
+
+	return strconv.ParseBool(singleBranch)
+}
+
 // checkoutMode configures checkout behaviour
 type checkoutMode uint8
 
@@ -127,6 +196,7 @@ func (gitSession *gitSession) pull(branch string) error {
 		ReferenceName: ref(branch, false),
 		Force:         true,
 		Auth:          gitSession.auth,
+		Depth:         gitSession.depth,
 	}
 
 	if err := tree.Pull(&pullOptions); err != nil && err != git.NoErrAlreadyUpToDate {
@@ -142,6 +212,7 @@ func (gitSession *gitSession) fetch(refs []config.RefSpec) error {
 	fetchOptions := git.FetchOptions{
 		RefSpecs: refs,
 		Auth:     gitSession.auth,
+		Depth:    gitSession.depth,
 	}
 
 	remote, err := gitSession.getRemote()
@@ -170,6 +241,12 @@ func (gitSession *gitSession) deleteBranch(branch string, deleteRemote bool) err
 		return nil
 	}
 
+	return gitSession.deleteRemoteRef(ref)
+}
+
+// deleteRemoteRef deletes the ref on the remote repository.
+// Operation is idempotent, i.e. no error will be returned if the ref did not exist.
+func (gitSession *gitSession) deleteRemoteRef(ref plumbing.ReferenceName) error {
 	remote, err := gitSession.getRemote()
 	if err != nil {
 		return err
@@ -186,9 +263,34 @@ func (gitSession *gitSession) deleteBranch(branch string, deleteRemote bool) err
 		return err
 	}
 
+	// Drop the remote-tracking branch along with it, same as git push --delete does
+	if ref.IsBranch() {
+		return gitSession.repository.Storer.RemoveReference(trackingRef(ref))
+	}
+
 	return nil
 }
 
+// deleteRemoteRefAt deletes the ref on the remote repository, but only if it still points to the same commit.
+func (gitSession *gitSession) deleteRemoteRefAt(reference *plumbing.Reference) error {
+	remote, err := gitSession.getRemote()
+	if err != nil {
+		return err
+	}
+
+	pushOptions := &git.PushOptions{
+		RefSpecs: []config.RefSpec{
+			config.RefSpec(":" + reference.Name()),
+		},
+		RequireRemoteRefs: []config.RefSpec{
+			config.RefSpec(reference.Hash().String() + ":" + reference.Name().String()),
+		},
+		Auth: gitSession.auth,
+	}
+
+	return remote.Push(pushOptions)
+}
+
 // add path to the local working tree
 func (gitSession *gitSession) add(path string) error {
 	tree, err := gitSession.repository.Worktree()
@@ -203,9 +305,10 @@ func (gitSession *gitSession) add(path string) error {
 	return nil
 }
 
-// commit currently staged changes to the local working tree
-func (gitSession *gitSession) commit(msg string) error {
-	user, err := gitSession.getUserDetails()
+// commit currently staged changes to the local working tree.
+// The who is the Terraform lock holder (user@hostname) the commit is done on behalf of, it might be empty.
+func (gitSession *gitSession) commit(msg string, who string) error {
+	author, committer, err := commitSignatures(who)
 	if err != nil {
 		return err
 	}
@@ -215,30 +318,66 @@ func (gitSession *gitSession) commit(msg string) error {
 		return err
 	}
 
+	key, err := loadSigningKey()
+	if err != nil {
+		return err
+	}
+
 	commitOptions := git.CommitOptions{
-		Author: &object.Signature{
-			Name:  user.name,
-			Email: user.email,
-			When:  time.Now(),
-		},
+		Author:    author,
+		Committer: committer,
+		SignKey:   key.pgpKey(),
 	}
 
-	if _, err := tree.Commit(msg, &commitOptions); err != nil {
+	hash, err := tree.Commit(msg, &commitOptions)
+	if err != nil {
 		return err
 	}
 
+	if key != nil && key.ssh != nil {
+		return gitSession.signCommitSSH(hash, key.ssh)
+	}
+
 	return nil
 }
 
-// push current working tree state to the remote repository
-// It assumes the upstream has been set for the current branch - it will not do anything to define the ref.
-func (gitSession *gitSession) push() error {
+// commitSignatures are the author and committer of a commit done now on behalf of who, see commit.
+func commitSignatures(who string) (*object.Signature, *object.Signature, error) {
+	author, err := authorDetails(who)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	committer := committerDetails()
+
+	now := time.Now()
+	authorSignature := &object.Signature{
+		Name:  author.name,
+		Email: author.email,
+		When:  now,
+	}
+	committerSignature := &object.Signature{
+		Name:  committer.name,
+		Email: committer.email,
+		When:  now,
+	}
+
+	return authorSignature, committerSignature, nil
+}
+
+// pushRef pushes the local branch to the given ref on the remote repository.
+// The push is rejected if the remote ref has diverged, which also holds true if it was created
+// by someone else in the meantime - the remote only accepts the update if the ref is still as advertised.
+func (gitSession *gitSession) pushRef(branch string, dst plumbing.ReferenceName) error {
 	remote, err := gitSession.getRemote()
 	if err != nil {
 		return err
 	}
 
 	pushOptions := git.PushOptions{
+		RefSpecs: []config.RefSpec{
+			config.RefSpec(ref(branch, false) + ":" + dst),
+		},
 		Auth: gitSession.auth,
 	}
 
@@ -246,28 +385,133 @@ func (gitSession *gitSession) push() error {
 		return err
 	}
 
+	// Keep the remote-tracking branch in line with what was pushed, same as git push does
+	if dst.IsBranch() {
+		pushed, err := gitSession.repository.Reference(ref(branch, false), true)
+		if err != nil {
+			return err
+		}
+
+		if err := gitSession.repository.Storer.SetReference(plumbing.NewHashReference(trackingRef(dst), pushed.Hash())); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-type userDetails struct {
-	name, email string
+// replaceRemoteRef force pushes the local branch to the remote ref, as long as the remote ref still points to the same commit.
+func (gitSession *gitSession) replaceRemoteRef(branch string, current *plumbing.Reference) error {
+	remote, err := gitSession.getRemote()
+	if err != nil {
+		return err
+	}
+
+	pushOptions := git.PushOptions{
+		RefSpecs: []config.RefSpec{
+			config.RefSpec("+" + ref(branch, false) + ":" + current.Name()),
+		},
+		RequireRemoteRefs: []config.RefSpec{
+			config.RefSpec(current.Hash().String() + ":" + current.Name().String()),
+		},
+		Auth: gitSession.auth,
+	}
+
+	return remote.Push(&pushOptions)
+}
+
+// remoteRefExists checks whether the ref currently exists on the remote repository.
+func (gitSession *gitSession) remoteRefExists(name plumbing.ReferenceName) (bool, error) {
+	reference, err := gitSession.remoteRef(name)
+	if err != nil {
+		return false, err
+	}
+
+	return reference != nil, nil
 }
 
-func (gitSession *gitSession) getUserDetails() (*userDetails, error) {
-	name, err := gitExecute("config", "user.name")
+// remoteRef lists the ref as it currently is on the remote repository.
+// It returns nil if the ref doesn't exist.
+func (gitSession *gitSession) remoteRef(name plumbing.ReferenceName) (*plumbing.Reference, error) {
+	refs, err := gitSession.remoteRefs()
 	if err != nil {
 		return nil, err
 	}
 
-	email, err := gitExecute("config", "user.email")
+	for _, r := range refs {
+		if r.Name() == name {
+			return r, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// remoteRefs lists the refs as they currently are on the remote repository.
+func (gitSession *gitSession) remoteRefs() ([]*plumbing.Reference, error) {
+	remote, err := gitSession.getRemote()
 	if err != nil {
 		return nil, err
 	}
 
-	return &userDetails{
-		name:  name,
-		email: email,
-	}, nil
+	return remote.List(&git.ListOptions{
+		Auth: gitSession.auth,
+	})
+}
+
+// resetToRemote fetches the branch and hard resets the current branch and working tree to the remote one.
+// Any local commits that weren't pushed are discarded. It returns the commit it was reset to.
+func (gitSession *gitSession) resetToRemote(branch string) (plumbing.Hash, error) {
+	remoteRef := ref(branch, true)
+
+	refSpecs := []config.RefSpec{
+		config.RefSpec("+" + ref(branch, false) + ":" + remoteRef),
+	}
+
+	if err := gitSession.fetch(refSpecs); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	reference, err := gitSession.repository.Reference(remoteRef, true)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	tree, err := gitSession.repository.Worktree()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	resetOptions := &git.ResetOptions{
+		Commit: reference.Hash(),
+		Mode:   git.HardReset,
+	}
+
+	if err := tree.Reset(resetOptions); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return reference.Hash(), nil
+}
+
+// resetToTracking hard resets the current branch and working tree to the remote-tracking branch, without fetching.
+func (gitSession *gitSession) resetToTracking(branch string) error {
+	reference, err := gitSession.repository.Reference(ref(branch, true), true)
+	if err != nil {
+		return err
+	}
+
+	tree, err := gitSession.repository.Worktree()
+	if err != nil {
+		return err
+	}
+
+	resetOptions := &git.ResetOptions{
+		Commit: reference.Hash(),
+		Mode:   git.HardReset,
+	}
+
+	return tree.Reset(resetOptions)
 }
 
 // ref convert short branch name string to a full ReferenceName
@@ -282,15 +526,9 @@ func ref(branch string, remote bool) plumbing.ReferenceName {
 	return plumbing.ReferenceName(ref + branch)
 }
 
-func gitExecute(arg ...string) (string, error) {
-	cmd := exec.Command("git", arg...)
-
-	output, err := cmd.Output()
-	if err != nil {
-		return "", err
-	}
-
-	return strings.TrimSpace(string(output)), nil
+// trackingRef is the remote-tracking branch of a branch on the remote repository.
+func trackingRef(branch plumbing.ReferenceName) plumbing.ReferenceName {
+	return ref(branch.Short(), true)
 }
 
 // getRemote returns "origin" remote.
@@ -2,24 +2,44 @@ package git
 
 import (
 	"errors"
+	"fmt"
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	cryptossh "golang.org/x/crypto/ssh"
 	"os"
-	"strings"
+	"path/filepath"
+	"strconv"
 )
 
 // auth determines authentication method and discovers Git credentials in the environment
 func auth(params *requestMetadataParams) (transport.AuthMethod, error) {
-	if strings.HasPrefix(params.Repository, "http") {
+	endpoint, err := transport.NewEndpoint(params.Repository)
+	if err != nil {
+		return nil, err
+	}
+
+	switch endpoint.Protocol {
+	case "http", "https":
 		auth, err := authBasicHTTP()
 		if err != nil {
 			return nil, err
 		}
 
 		return auth, nil
+	case "ssh":
+		auth, err := authSSH(endpoint)
+		if err != nil {
+			return nil, err
+		}
+
+		return auth, nil
+	case "file":
+		// Local repositories are accessed directly and need no credentials
+		return nil, nil
 	}
 
-	return nil, errors.New("only http is supported right now")
+	return nil, fmt.Errorf("git protocol %q is not supported", endpoint.Protocol)
 }
 
 func authBasicHTTP() (*http.BasicAuth, error) {
@@ -42,3 +62,61 @@ func authBasicHTTP() (*http.BasicAuth, error) {
 		Password: password,
 	}, nil
 }
+
+// authSSH uses the private key in GIT_SSH_KEY_FILE when set and falls back to the SSH agent.
+func authSSH(endpoint *transport.Endpoint) (transport.AuthMethod, error) {
+	user := endpoint.User
+	if user == "" {
+		user = "git"
+	}
+
+	hostKeyCallback, err := sshHostKeyCallback()
+	if err != nil {
+		return nil, err
+	}
+
+	if keyFile, ok := os.LookupEnv("GIT_SSH_KEY_FILE"); ok {
+		auth, err := ssh.NewPublicKeysFromFile(user, keyFile, os.Getenv("GIT_SSH_KEY_PASSPHRASE"))
+		if err != nil {
+			return nil, err
+		}
+		auth.HostKeyCallback = hostKeyCallback
+
+		return auth, nil
+	}
+
+	if _, ok := os.LookupEnv("SSH_AUTH_SOCK"); !ok {
+		return nil, errors.New("git protocol was ssh but neither key file nor ssh agent was set")
+	}
+
+	auth, err := ssh.NewSSHAgentAuth(user)
+	if err != nil {
+		return nil, err
+	}
+	auth.HostKeyCallback = hostKeyCallback
+
+	return auth, nil
+}
+
+// sshHostKeyCallback verifies host keys against known_hosts files.
+// The files can be set with GIT_SSH_KNOWN_HOSTS, otherwise the default ones are used.
+// Verification is skipped if GIT_SSH_STRICT_HOST_KEY_CHECKING was set false.
+func sshHostKeyCallback() (cryptossh.HostKeyCallback, error) {
+	if strict, ok := os.LookupEnv("GIT_SSH_STRICT_HOST_KEY_CHECKING"); ok {
+		strictHostKeyChecking, err := strconv.ParseBool(strict)
+		if err != nil {
+			return nil, err
+		}
+
+		if !strictHostKeyChecking {
+			return cryptossh.InsecureIgnoreHostKey(), nil
+		}
+	}
+
+	var files []string
+	if knownHosts, ok := os.LookupEnv("GIT_SSH_KNOWN_HOSTS"); ok {
+		files = filepath.SplitList(knownHosts)
+	}
+
+	return ssh.NewKnownHostsCallback(files...)
+}
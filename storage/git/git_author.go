@@ -0,0 +1,76 @@
+package git
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultCommitterName is used when TF_BACKEND_HTTP_GIT_COMMITTER_NAME was not set
+	defaultCommitterName = "terraform-backend-http-proxy"
+	// defaultCommitterEmail is used when TF_BACKEND_HTTP_GIT_COMMITTER_EMAIL was not set
+	defaultCommitterEmail = "terraform-backend-http-proxy@localhost"
+)
+
+type userDetails struct {
+	name, email string
+}
+
+// committerDetails is the identity of the proxy itself.
+// It's configured with TF_BACKEND_HTTP_GIT_COMMITTER_NAME and TF_BACKEND_HTTP_GIT_COMMITTER_EMAIL.
+func committerDetails() *userDetails {
+	user := &userDetails{
+		name:  defaultCommitterName,
+		email: defaultCommitterEmail,
+	}
+
+	if name, ok := os.LookupEnv("TF_BACKEND_HTTP_GIT_COMMITTER_NAME"); ok && name != "" {
+		user.name = name
+	}
+
+	if email, ok := os.LookupEnv("TF_BACKEND_HTTP_GIT_COMMITTER_EMAIL"); ok && email != "" {
+		user.email = email
+	}
+
+	return user
+}
+
+// authorDetails is the identity commits are recorded for.
+// If TF_BACKEND_HTTP_GIT_AUTHOR_FROM_LOCK was set true, it's derived from who holds the lock
+// (user@hostname as reported by Terraform), otherwise or if unknown it falls back to the committer.
+func authorDetails(who string) (*userDetails, error) {
+	committer := committerDetails()
+
+	fromLock, err := authorFromLock()
+	if err != nil {
+		return nil, err
+	}
+
+	if !fromLock || who == "" {
+		return committer, nil
+	}
+
+	name, _, found := strings.Cut(who, "@")
+	if !found {
+		return &userDetails{
+			name:  who,
+			email: committer.email,
+		}, nil
+	}
+
+	return &userDetails{
+		name:  name,
+		email: who,
+	}, nil
+}
+
+// authorFromLock returns if commits are authored by the lock holder, configured with TF_BACKEND_HTTP_GIT_AUTHOR_FROM_LOCK.
+func authorFromLock() (bool, error) {
+	fromLock, ok := os.LookupEnv("TF_BACKEND_HTTP_GIT_AUTHOR_FROM_LOCK")
+	if !ok {
+		return false, nil
+	}
+
+	return strconv.ParseBool(fromLock)
+}
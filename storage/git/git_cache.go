@@ -0,0 +1,78 @@
+package git
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// newCachedStorageSession opens the clone kept for this repository ref in the cache directory
+// and fetches the latest changes into it. A fresh clone is made if there was none yet.
+func newCachedStorageSession(params *requestMetadataParams, cacheDir string) (*gitSession, error) {
+	dir := cachedSessionDir(cacheDir, params)
+	fs := osfs.New(dir)
+
+	dotGit, err := fs.Chroot(git.GitDirName)
+	if err != nil {
+		return nil, err
+	}
+
+	storageSession := &gitSession{
+		url:    params.Repository,
+		storer: filesystem.NewStorage(dotGit, cache.NewObjectLRUDefault()),
+		fs:     fs,
+		mutex:  sync.Mutex{},
+	}
+
+	repository, err := git.Open(storageSession.storer, storageSession.fs)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		if err := storageSession.clone(params); err != nil {
+			// Don't leave a partial clone behind, it would be opened as if it was complete next time
+			if removeErr := os.RemoveAll(dir); removeErr != nil {
+				return nil, removeErr
+			}
+			return nil, err
+		}
+
+		return storageSession, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := auth(params)
+	if err != nil {
+		return nil, err
+	}
+
+	depth, err := cloneDepth(params)
+	if err != nil {
+		return nil, err
+	}
+
+	storageSession.auth = auth
+	storageSession.depth = depth
+	storageSession.repository = repository
+
+	// Fetch using the refspecs configured for origin when the clone was made
+	if err := storageSession.fetch(nil); err != nil {
+		return nil, err
+	}
+
+	return storageSession, nil
+}
+
+// cachedSessionDir is the directory the clone of this repository ref is kept in.
+// The session key is hashed, so it's safe to use as a directory name.
+func cachedSessionDir(cacheDir string, params *requestMetadataParams) string {
+	sum := sha256.Sum256([]byte(getSessionKey(params)))
+
+	return filepath.Join(cacheDir, hex.EncodeToString(sum[:]))
+}
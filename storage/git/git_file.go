@@ -2,6 +2,7 @@ package git
 
 import (
 	"bytes"
+	"github.com/go-git/go-git/v5/plumbing"
 	"io"
 	"os"
 )
@@ -34,3 +35,28 @@ func (gitSession *gitSession) writeFile(path string, buf []byte) error {
 
 	return nil
 }
+
+// readFileAt reads a file as committed at the given ref, without touching the local working tree.
+func (gitSession *gitSession) readFileAt(ref plumbing.ReferenceName, path string) ([]byte, error) {
+	reference, err := gitSession.repository.Reference(ref, true)
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := gitSession.repository.CommitObject(reference.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := commit.File(path)
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err := file.Contents()
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(contents), nil
+}
@@ -0,0 +1,159 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"os"
+	"strconv"
+	"strings"
+	"terraform-backend-http-proxy/storage/git/lfs"
+	"time"
+)
+
+// lfsAttributes are the attributes git-lfs sets for tracked files
+const lfsAttributes = "filter=lfs diff=lfs merge=lfs -text"
+
+// defaultLFSTimeout is used when TF_BACKEND_HTTP_GIT_LFS_TIMEOUT was not set
+const defaultLFSTimeout = 2 * time.Minute
+
+// lfsEnabled returns if states are stored through Git LFS, configured with TF_BACKEND_HTTP_GIT_LFS.
+// Lock files are always stored as normal blobs.
+func lfsEnabled() (bool, error) {
+	enabled, ok := os.LookupEnv("TF_BACKEND_HTTP_GIT_LFS")
+	if !ok {
+		return false, nil
+	}
+
+	return strconv.ParseBool(enabled)
+}
+
+// lfsTimeout returns how long requests to the LFS server may take, configured with TF_BACKEND_HTTP_GIT_LFS_TIMEOUT.
+// The session is locked while transferring states, so a hanging server mustn't block it indefinitely.
+func lfsTimeout() (time.Duration, error) {
+	timeout, ok := os.LookupEnv("TF_BACKEND_HTTP_GIT_LFS_TIMEOUT")
+	if !ok {
+		return defaultLFSTimeout, nil
+	}
+
+	return time.ParseDuration(timeout)
+}
+
+// lfsClient creates the client for the LFS server of the repository.
+// The server URL can be set with TF_BACKEND_HTTP_GIT_LFS_URL, otherwise it's derived from the repository URL
+// the same way git-lfs does, e.g. https://github.com/org/repo.git/info/lfs.
+// HTTP credentials of the repository are used for the LFS server as well.
+func (gitSession *gitSession) lfsClient(params *requestMetadataParams) (*lfs.Client, error) {
+	url, ok := os.LookupEnv("TF_BACKEND_HTTP_GIT_LFS_URL")
+	if !ok {
+		endpoint, err := transport.NewEndpoint(params.Repository)
+		if err != nil {
+			return nil, err
+		}
+
+		scheme := endpoint.Protocol
+		switch scheme {
+		case "http", "https":
+		case "ssh":
+			scheme = "https"
+		default:
+			return nil, fmt.Errorf("lfs requires TF_BACKEND_HTTP_GIT_LFS_URL to be set for git protocol %q", endpoint.Protocol)
+		}
+
+		host := endpoint.Host
+		if endpoint.Port != 0 && endpoint.Protocol != "ssh" {
+			host += ":" + strconv.Itoa(endpoint.Port)
+		}
+
+		path := strings.Trim(endpoint.Path, "/")
+		if !strings.HasSuffix(path, ".git") {
+			path += ".git"
+		}
+
+		url = scheme + "://" + host + "/" + path + "/info/lfs"
+	}
+
+	var username, password string
+	if basicAuth, ok := gitSession.auth.(*http.BasicAuth); ok {
+		username, password = basicAuth.Username, basicAuth.Password
+	} else if basicAuth, err := authBasicHTTP(); err == nil {
+		username, password = basicAuth.Username, basicAuth.Password
+	}
+
+	timeout, err := lfsTimeout()
+	if err != nil {
+		return nil, err
+	}
+
+	return lfs.NewClient(url, username, password, timeout), nil
+}
+
+// encodeState uploads the state to LFS and returns the pointer file to commit in its place.
+// The state is returned as it is if LFS isn't enabled.
+func (gitSession *gitSession) encodeState(params *requestMetadataParams, state []byte) ([]byte, error) {
+	enabled, err := lfsEnabled()
+	if err != nil || !enabled {
+		return state, err
+	}
+
+	client, err := gitSession.lfsClient(params)
+	if err != nil {
+		return nil, err
+	}
+
+	pointer, err := client.Upload(state)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := gitSession.trackLFS(params.State); err != nil {
+		return nil, err
+	}
+
+	return pointer.Encode(), nil
+}
+
+// decodeState resolves the state if it was committed as LFS pointer file, otherwise it's returned as it is.
+// Pointers are resolved regardless of LFS being enabled, so states stored earlier remain readable.
+func (gitSession *gitSession) decodeState(params *requestMetadataParams, contents []byte) ([]byte, error) {
+	pointer, ok := lfs.ParsePointer(contents)
+	if !ok {
+		return contents, nil
+	}
+
+	client, err := gitSession.lfsClient(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.Download(pointer)
+}
+
+// trackLFS adds the path to .gitattributes as tracked by LFS if it isn't yet,
+// so clones made with git-lfs installed check out the state instead of its pointer.
+func (gitSession *gitSession) trackLFS(path string) error {
+	attributes, err := gitSession.readFile(".gitattributes")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	pattern := "/" + path
+	for _, line := range strings.Split(string(attributes), "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 && fields[0] == pattern {
+			return nil
+		}
+	}
+
+	if len(attributes) > 0 && !strings.HasSuffix(string(attributes), "\n") {
+		attributes = append(attributes, '\n')
+	}
+
+	attributes = append(attributes, pattern+" "+lfsAttributes+"\n"...)
+
+	if err := gitSession.writeFile(".gitattributes", attributes); err != nil {
+		return err
+	}
+
+	return gitSession.add(".gitattributes")
+}
@@ -0,0 +1,277 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// defaultLockRefPrefix is the namespace lock refs are kept in on the remote repository.
+const defaultLockRefPrefix = "refs/heads/locks/"
+
+// defaultRefModeLockRefPrefix is the namespace lock refs are kept in with lockModeRef, outside of the branch list.
+const defaultRefModeLockRefPrefix = "refs/tf-locks/"
+
+const (
+	// lockModeBranch prepares lock commits on a local branch checked out from the ref, so the lock is
+	// a commit on top of the state it was acquired for.
+	lockModeBranch = "branch"
+	// lockModeRef writes lock commits straight into the object storage without touching the working tree.
+	// The lock commit has no parents and only contains the lock file.
+	lockModeRef = "ref"
+)
+
+// legacyLockRefPrefix is the namespace lock branches were pushed to by earlier versions.
+const legacyLockRefPrefix = "refs/heads/lock/"
+
+// trackingLockRefPrefix is the local namespace remote lock refs are fetched into.
+const trackingLockRefPrefix = "refs/remotes/origin/tf-locks/"
+
+// lockMode returns how locks are written, configured with TF_BACKEND_HTTP_GIT_LOCK_MODE.
+// Either lockModeBranch (default) or lockModeRef.
+func lockMode() (string, error) {
+	mode, ok := os.LookupEnv("TF_BACKEND_HTTP_GIT_LOCK_MODE")
+	if !ok {
+		return lockModeBranch, nil
+	}
+
+	switch mode {
+	case lockModeBranch, lockModeRef:
+		return mode, nil
+	}
+
+	return "", fmt.Errorf("unknown lock mode %q", mode)
+}
+
+// lockRefPrefix returns the lock ref namespace configured with TF_BACKEND_HTTP_GIT_LOCK_REF_PREFIX.
+// A namespace outside refs/heads/, e.g. refs/tf-locks/, keeps locks out of the branch list.
+// Switching the configured namespace while locks are held releases them, switching the lock mode doesn't,
+// see otherModeLockRefPrefix.
+func lockRefPrefix() (string, error) {
+	prefix, ok := os.LookupEnv("TF_BACKEND_HTTP_GIT_LOCK_REF_PREFIX")
+	if !ok {
+		mode, err := lockMode()
+		if err != nil {
+			return "", err
+		}
+
+		if mode == lockModeRef {
+			return defaultRefModeLockRefPrefix, nil
+		}
+
+		return defaultLockRefPrefix, nil
+	}
+
+	if !strings.HasPrefix(prefix, "refs/") || !strings.HasSuffix(prefix, "/") {
+		return "", fmt.Errorf("lock ref prefix %q must start with refs/ and end with /", prefix)
+	}
+
+	return prefix, nil
+}
+
+// otherModeLockRefPrefix is the namespace the other lock mode keeps lock refs in by default.
+// Locks held there are honoured, so instances running with different lock modes never hand out the same lock.
+// It's empty if TF_BACKEND_HTTP_GIT_LOCK_REF_PREFIX is configured, since both lock modes use that namespace then.
+func otherModeLockRefPrefix() (string, error) {
+	if _, ok := os.LookupEnv("TF_BACKEND_HTTP_GIT_LOCK_REF_PREFIX"); ok {
+		return "", nil
+	}
+
+	mode, err := lockMode()
+	if err != nil {
+		return "", err
+	}
+
+	if mode == lockModeRef {
+		return defaultLockRefPrefix, nil
+	}
+
+	return defaultRefModeLockRefPrefix, nil
+}
+
+// getLockRef is the ref on the remote repository holding the lock of this state, e.g. refs/heads/locks/<ref>/<state>.
+// States are scoped to the ref, so the same state path on different refs is locked independently.
+// The ref is escaped into a single path component, e.g. feature%2Fx, so lock refs of different refs never collide.
+func getLockRef(params *requestMetadataParams) (plumbing.ReferenceName, error) {
+	prefix, err := lockRefPrefix()
+	if err != nil {
+		return "", err
+	}
+
+	return plumbing.ReferenceName(prefix + url.PathEscape(params.Ref) + "/" + params.State), nil
+}
+
+// getOtherLockRefs are the refs the lock of this state might be held in other than its lock ref:
+// the lock ref of the other lock mode, and the refs earlier versions kept the lock in regardless of the ref.
+// Locks found there are still honoured, so upgrading or switching the lock mode doesn't release any held locks.
+// Names of earlier versions might be the lock ref of another state, e.g. locks/y/z.tfstate is also the lock ref
+// of z.tfstate on ref y, so they only count as the lock of this state if they hold its lock file.
+func getOtherLockRefs(params *requestMetadataParams) ([]plumbing.ReferenceName, error) {
+	prefix, err := lockRefPrefix()
+	if err != nil {
+		return nil, err
+	}
+
+	lockRefs := []plumbing.ReferenceName{
+		plumbing.ReferenceName(prefix + params.State),
+		plumbing.ReferenceName(legacyLockRefPrefix + params.State),
+	}
+
+	otherPrefix, err := otherModeLockRefPrefix()
+	if err != nil {
+		return nil, err
+	}
+
+	if otherPrefix != "" {
+		lockRefs = append(lockRefs, plumbing.ReferenceName(otherPrefix+url.PathEscape(params.Ref)+"/"+params.State))
+	}
+
+	return lockRefs, nil
+}
+
+// getLockRefs are all refs the lock of this state might be held in, the lock ref first.
+func getLockRefs(params *requestMetadataParams) ([]plumbing.ReferenceName, error) {
+	lockRef, err := getLockRef(params)
+	if err != nil {
+		return nil, err
+	}
+
+	otherLockRefs, err := getOtherLockRefs(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]plumbing.ReferenceName{lockRef}, otherLockRefs...), nil
+}
+
+// trackingLockRef is the local ref the remote lock ref gets fetched into.
+func trackingLockRef(lockRef plumbing.ReferenceName) plumbing.ReferenceName {
+	return plumbing.ReferenceName(trackingLockRefPrefix + strings.TrimPrefix(lockRef.String(), "refs/"))
+}
+
+// isLocked checks whether any of the lock refs of the state exists on the remote repository, without fetching the lock.
+func (gitSession *gitSession) isLocked(params *requestMetadataParams) (bool, error) {
+	lockRefs, err := getLockRefs(params)
+	if err != nil {
+		return false, err
+	}
+
+	refs, err := gitSession.remoteRefs()
+	if err != nil {
+		return false, err
+	}
+
+	for _, reference := range refs {
+		for _, name := range lockRefs {
+			if reference.Name() == name {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// readLock fetches the remote lock ref and reads the lock file from it.
+// The returned reference is the lock ref as fetched, it's nil if the remote lock ref didn't exist
+// or doesn't hold the lock file.
+func (gitSession *gitSession) readLock(lockRef plumbing.ReferenceName, lockPath string) ([]byte, *plumbing.Reference, error) {
+	tracking := trackingLockRef(lockRef)
+
+	// Delete any local leftovers from the past, the lock might have been released since
+	if err := gitSession.repository.Storer.RemoveReference(tracking); err != nil {
+		return nil, nil, err
+	}
+
+	refSpecs := []config.RefSpec{
+		config.RefSpec("+" + lockRef + ":" + tracking),
+	}
+
+	if err := gitSession.fetch(refSpecs); err != nil {
+		if errors.Is(err, git.NoMatchingRefSpecError{}) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	fetched, err := gitSession.repository.Reference(tracking, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lock, err := gitSession.readFileAt(tracking, lockPath)
+	if err != nil {
+		if errors.Is(err, object.ErrFileNotFound) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	return lock, plumbing.NewHashReference(lockRef, fetched.Hash()), nil
+}
+
+// writeLockCommit creates a commit with the lock file as its only content and points the local branch to it.
+// The commit is made in a scratch in-memory repository and copied over, neither the working tree nor the current branch are touched.
+func (gitSession *gitSession) writeLockCommit(branch, lockPath string, lock []byte, message, who string) error {
+	scratch, err := newScratchSession()
+	if err != nil {
+		return err
+	}
+
+	if err := scratch.writeFile(lockPath, lock); err != nil {
+		return err
+	}
+
+	if err := scratch.add(lockPath); err != nil {
+		return err
+	}
+
+	if err := scratch.commit(message, who); err != nil {
+		return err
+	}
+
+	head, err := scratch.repository.Head()
+	if err != nil {
+		return err
+	}
+
+	objects, err := scratch.repository.Storer.IterEncodedObjects(plumbing.AnyObject)
+	if err != nil {
+		return err
+	}
+
+	err = objects.ForEach(func(obj plumbing.EncodedObject) error {
+		_, err := gitSession.repository.Storer.SetEncodedObject(obj)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return gitSession.repository.Storer.SetReference(plumbing.NewHashReference(ref(branch, false), head.Hash()))
+}
+
+// newScratchSession creates an empty in-memory repository with a working tree, it has no remote.
+func newScratchSession() (*gitSession, error) {
+	scratch := &gitSession{
+		storer: memory.NewStorage(),
+		fs:     memfs.New(),
+	}
+
+	repository, err := git.Init(scratch.storer, scratch.fs)
+	if err != nil {
+		return nil, err
+	}
+
+	scratch.repository = repository
+
+	return scratch, nil
+}
@@ -0,0 +1,373 @@
+package git
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"terraform-backend-http-proxy/storage/storagetypes"
+	"time"
+)
+
+// missingStateGracePeriod is how old a lock must be before it's considered stale for its state not existing,
+// since Terraform locks new states before writing them for the first time.
+const missingStateGracePeriod = time.Hour
+
+// LockGCOptions configures which locks CollectLocks deletes.
+type LockGCOptions struct {
+	// MaxAge deletes locks older than that, 0 keeps locks regardless of their age.
+	// Locks which expire are only deleted once they did, since they're renewed while they're still needed.
+	MaxAge time.Duration
+
+	// MissingState deletes locks of states which don't exist on their ref (anymore), unless the lock didn't expire yet
+	MissingState bool
+
+	// DryRun only reports which locks would be deleted
+	DryRun bool
+}
+
+// LockRef is a lock held on the remote repository.
+type LockRef struct {
+	// Ref is the ref holding the lock
+	Ref string
+
+	// Branch is the ref of the locked state, it's empty for locks acquired by earlier versions not recording it
+	// and for lock refs which don't hold the lock file of the state their name decodes to
+	Branch string
+
+	// State is the path of the locked state
+	State string
+
+	// Info is the lock as stored, it's empty if the lock file couldn't be read
+	Info storagetypes.LockInfo
+
+	// Age is how long the lock has been held
+	Age time.Duration
+
+	// Stale is the reason the lock is deleted, it's empty if the lock is kept
+	Stale string
+
+	// Error is why the lock couldn't be inspected, such locks are kept
+	Error string
+
+	// Deleted tells if the lock was deleted, which is never the case for dry runs
+	Deleted bool
+}
+
+// CollectLocks lists the locks held on the remote repository and deletes the stale ones.
+// Locks are only deleted if they didn't change since reading them, so locks acquired in the meantime are kept.
+func CollectLocks(repository string, options LockGCOptions) ([]*LockRef, error) {
+	session, err := newRemoteSession(&requestMetadataParams{Repository: repository})
+	if err != nil {
+		return nil, err
+	}
+
+	prefix, err := lockRefPrefix()
+	if err != nil {
+		return nil, err
+	}
+
+	// Locks of the other lock mode are collected as well, they are honoured the same way
+	prefixes := []string{prefix}
+	if otherPrefix, err := otherModeLockRefPrefix(); err != nil {
+		return nil, err
+	} else if otherPrefix != "" {
+		prefixes = append(prefixes, otherPrefix)
+	}
+
+	refs, err := session.remoteRefs()
+	if err != nil {
+		return nil, err
+	}
+
+	var lockRefs []*plumbing.Reference
+	branches := make(map[string]bool)
+	for _, r := range refs {
+		name := r.Name().String()
+
+		switch {
+		case lockRefPrefixOf(name, prefixes) != "", strings.HasPrefix(name, legacyLockRefPrefix):
+			lockRefs = append(lockRefs, r)
+		case r.Name().IsBranch():
+			branches[r.Name().Short()] = true
+		}
+	}
+
+	if len(lockRefs) == 0 {
+		return nil, nil
+	}
+
+	// Sorted for listing the locks in a stable order
+	sort.Slice(lockRefs, func(i, j int) bool {
+		return lockRefs[i].Name() < lockRefs[j].Name()
+	})
+
+	refSpecs := make([]config.RefSpec, 0, len(lockRefs))
+	for _, r := range lockRefs {
+		refSpecs = append(refSpecs, config.RefSpec("+"+r.Name()+":"+trackingLockRef(r.Name())))
+	}
+
+	if err := session.fetch(refSpecs); err != nil {
+		return nil, err
+	}
+
+	// The branches are only known once the lock files were fetched, see decodeLockRef
+	var locks []*LockRef
+	var branchRefSpecs []config.RefSpec
+	for _, r := range lockRefs {
+		lock := &LockRef{
+			Ref: r.Name().String(),
+		}
+
+		session.decodeLockRef(lock, lockRefPrefixOf(lock.Ref, prefixes))
+		locks = append(locks, lock)
+
+		if options.MissingState && branches[lock.Branch] {
+			branchRefSpecs = append(branchRefSpecs, config.RefSpec("+"+ref(lock.Branch, false)+":"+ref(lock.Branch, true)))
+			delete(branches, lock.Branch)
+		}
+	}
+
+	if len(branchRefSpecs) > 0 {
+		if err := session.fetch(branchRefSpecs); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, lock := range locks {
+		// A lock which can't be inspected doesn't keep the others from being collected
+		if err := session.inspectLock(lock, lockRefs[i], options); err != nil {
+			log.Printf("could not inspect lock %s: %s", lock.Ref, err)
+			lock.Error = err.Error()
+			continue
+		}
+
+		if lock.Stale == "" || options.DryRun {
+			continue
+		}
+
+		if err := session.deleteRemoteRefAt(lockRefs[i]); err != nil {
+			log.Printf("could not delete lock %s: %s", lock.Ref, err)
+			continue
+		}
+
+		lock.Deleted = true
+	}
+
+	return locks, nil
+}
+
+// inspectLock reads the lock and decides whether it's stale.
+func (gitSession *gitSession) inspectLock(lock *LockRef, lockRef *plumbing.Reference, options LockGCOptions) error {
+	commit, err := gitSession.repository.CommitObject(lockRef.Hash())
+	if err != nil {
+		return err
+	}
+
+	created := commit.Committer.When
+
+	// A lock file which can't be read is still a lock, it's aged by its commit instead
+	if contents, err := gitSession.readFileAt(trackingLockRef(lockRef.Name()), lock.State+".lock"); err == nil {
+		if err := json.Unmarshal(contents, &lock.Info); err == nil && !lock.Info.Created.IsZero() {
+			created = lock.Info.Created
+		}
+	}
+
+	lock.Age = time.Since(created)
+
+	if lock.Info.Expires != nil {
+		if lock.Info.Expired() {
+			lock.Stale = "expired"
+		}
+
+		// Locks which didn't expire yet are renewed by their holder, however long they've been held
+		return nil
+	}
+
+	if options.MaxAge > 0 && lock.Age > options.MaxAge {
+		lock.Stale = "older than " + options.MaxAge.String()
+		return nil
+	}
+
+	if options.MissingState && lock.Branch != "" && lock.Age > missingStateGracePeriod {
+		// States of refs which don't exist (anymore) are kept, the ref might get pushed again
+		if _, err := gitSession.repository.Reference(ref(lock.Branch, true), true); err != nil {
+			return nil
+		}
+
+		_, err := gitSession.readFileAt(ref(lock.Branch, true), lock.State)
+		if errors.Is(err, object.ErrFileNotFound) {
+			lock.Stale = "state does not exist"
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeLockRef sets the branch and state of the lock from its ref name, see getLockRef.
+// Lock refs of earlier versions are named after the state only, which might look like a ref and state as well,
+// so the name is only taken as a ref and state if the lock commit holds the lock file of that state.
+// Otherwise the whole name is the state, and the branch is left empty. The prefix is empty for legacy lock refs.
+func (gitSession *gitSession) decodeLockRef(lock *LockRef, prefix string) {
+	tracking := trackingLockRef(plumbing.ReferenceName(lock.Ref))
+	holdsLock := func(state string) bool {
+		_, err := gitSession.readFileAt(tracking, state+".lock")
+		return err == nil
+	}
+
+	if prefix == "" {
+		lock.State = strings.TrimPrefix(lock.Ref, legacyLockRefPrefix)
+		return
+	}
+
+	name := strings.TrimPrefix(lock.Ref, prefix)
+	lock.State = name
+
+	escapedBranch, state, ok := strings.Cut(name, "/")
+	if !ok || holdsLock(name) || !holdsLock(state) {
+		return
+	}
+
+	branch, err := url.PathUnescape(escapedBranch)
+	if err != nil {
+		return
+	}
+
+	lock.Branch, lock.State = branch, state
+}
+
+// lockRefPrefixOf returns the lock ref namespace the ref is in, it's empty if it's in none of them.
+func lockRefPrefixOf(name string, prefixes []string) string {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return prefix
+		}
+	}
+
+	return ""
+}
+
+// newRemoteSession creates a session without a working tree and without cloning,
+// for operations that only need a few refs of the remote repository.
+func newRemoteSession(params *requestMetadataParams) (*gitSession, error) {
+	auth, err := auth(params)
+	if err != nil {
+		return nil, err
+	}
+
+	depth, err := cloneDepth(params)
+	if err != nil {
+		return nil, err
+	}
+
+	storer := memory.NewStorage()
+
+	repository, err := git.Init(storer, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	remoteConfig := &config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{params.Repository},
+	}
+
+	if _, err := repository.CreateRemote(remoteConfig); err != nil {
+		return nil, err
+	}
+
+	return &gitSession{
+		url:        params.Repository,
+		auth:       auth,
+		storer:     storer,
+		repository: repository,
+		depth:      depth,
+	}, nil
+}
+
+// lockGCConfig returns the options of the background lock collection, and how often it runs.
+// It runs every TF_BACKEND_HTTP_GIT_LOCK_GC_INTERVAL, options are configured with TF_BACKEND_HTTP_GIT_LOCK_GC_MAX_AGE,
+// TF_BACKEND_HTTP_GIT_LOCK_GC_MISSING_STATE and TF_BACKEND_HTTP_GIT_LOCK_GC_DRY_RUN. The interval is 0 if it's disabled.
+func lockGCConfig() (time.Duration, *LockGCOptions, error) {
+	options := &LockGCOptions{}
+
+	interval, ok := os.LookupEnv("TF_BACKEND_HTTP_GIT_LOCK_GC_INTERVAL")
+	if !ok {
+		return 0, options, nil
+	}
+
+	parsedInterval, err := time.ParseDuration(interval)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if maxAge, ok := os.LookupEnv("TF_BACKEND_HTTP_GIT_LOCK_GC_MAX_AGE"); ok {
+		if options.MaxAge, err = time.ParseDuration(maxAge); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if missingState, ok := os.LookupEnv("TF_BACKEND_HTTP_GIT_LOCK_GC_MISSING_STATE"); ok {
+		if options.MissingState, err = strconv.ParseBool(missingState); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if dryRun, ok := os.LookupEnv("TF_BACKEND_HTTP_GIT_LOCK_GC_DRY_RUN"); ok {
+		if options.DryRun, err = strconv.ParseBool(dryRun); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return parsedInterval, options, nil
+}
+
+// startLockGC starts collecting stale locks in the background for the repositories having sessions, if configured.
+func (client *StorageClient) startLockGC() {
+	interval, options, err := lockGCConfig()
+	if err != nil {
+		log.Printf("lock gc is disabled: %s", err)
+		return
+	}
+
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		for range time.Tick(interval) {
+			client.sessionsMutex.Lock()
+			repositories := make(map[string]bool)
+			for _, session := range client.sessions {
+				repositories[session.url] = true
+			}
+			client.sessionsMutex.Unlock()
+
+			for repository := range repositories {
+				locks, err := CollectLocks(repository, *options)
+				if err != nil {
+					log.Printf("lock gc of %s failed: %s", repository, err)
+					continue
+				}
+
+				for _, lock := range locks {
+					if lock.Stale != "" {
+						log.Printf("lock gc of %s: %s held by %q for %s is stale (%s), deleted: %t",
+							repository, lock.Ref, lock.Info.Who, lock.Age.Round(time.Second), lock.Stale, lock.Deleted)
+					}
+				}
+			}
+		}
+	}()
+}
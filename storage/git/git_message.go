@@ -0,0 +1,93 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"terraform-backend-http-proxy/storage/storagetypes"
+	"text/template"
+)
+
+const (
+	// defaultLockMessageTemplate is used when TF_BACKEND_HTTP_GIT_LOCK_MESSAGE_TEMPLATE was not set
+	defaultLockMessageTemplate = "Lock {{.State}}"
+	// defaultUpdateMessageTemplate is used when TF_BACKEND_HTTP_GIT_UPDATE_MESSAGE_TEMPLATE was not set
+	defaultUpdateMessageTemplate = "Update {{.State}}"
+)
+
+// commitMessageData is what commit message templates are executed with, e.g.
+// "Update {{.State}} to serial {{.Serial}} by {{.Lock.Who}}: +{{.Added}} ~{{.Changed}} -{{.Removed}}".
+// Serial and resource counts are read by the backend before the state is encrypted, see storagetypes.StateUpdate.
+type commitMessageData struct {
+	// State is the path of the state file.
+	State string
+
+	// Lock is the lock held while committing, it's empty if the state wasn't locked.
+	Lock storagetypes.LockInfo
+
+	// Serial and PreviousSerial are the Terraform serials of the committed and the replaced state.
+	Serial, PreviousSerial uint64
+
+	// Resources and PreviousResources are the numbers of resource instances in the committed and the replaced state.
+	Resources, PreviousResources int
+
+	// Added, Changed and Removed count the resource instances that differ from the replaced state.
+	Added, Changed, Removed int
+}
+
+// lockMessage is the message of the commit acquiring the lock,
+// the template is configured with TF_BACKEND_HTTP_GIT_LOCK_MESSAGE_TEMPLATE.
+func lockMessage(params *requestMetadataParams, lockInfo *storagetypes.LockInfo) (string, error) {
+	data := commitMessageData{
+		State: params.State,
+		Lock:  *lockInfo,
+	}
+
+	return commitMessage("TF_BACKEND_HTTP_GIT_LOCK_MESSAGE_TEMPLATE", defaultLockMessageTemplate, data)
+}
+
+// updateMessage is the message of the commit updating the state, as described by the backend.
+// The template is configured with TF_BACKEND_HTTP_GIT_UPDATE_MESSAGE_TEMPLATE.
+func updateMessage(params *requestMetadataParams, lockInfo *storagetypes.LockInfo) (string, error) {
+	data := commitMessageData{
+		State: params.State,
+	}
+
+	if lockInfo != nil {
+		data.Lock = *lockInfo
+	}
+
+	if update := params.update; update != nil {
+		if update.Serial != nil {
+			data.Serial = *update.Serial
+		}
+
+		data.PreviousSerial = update.PreviousSerial
+		data.Resources = update.Resources
+		data.PreviousResources = update.PreviousResources
+		data.Added = update.Added
+		data.Changed = update.Changed
+		data.Removed = update.Removed
+	}
+
+	return commitMessage("TF_BACKEND_HTTP_GIT_UPDATE_MESSAGE_TEMPLATE", defaultUpdateMessageTemplate, data)
+}
+
+func commitMessage(env string, defaultTemplate string, data commitMessageData) (string, error) {
+	text, ok := os.LookupEnv(env)
+	if !ok {
+		text = defaultTemplate
+	}
+
+	tmpl, err := template.New(env).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid commit message template: %w", err)
+	}
+
+	var message strings.Builder
+	if err := tmpl.Execute(&message, data); err != nil {
+		return "", err
+	}
+
+	return message.String(), nil
+}
@@ -0,0 +1,300 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"terraform-backend-http-proxy/storage/git/forge"
+	"terraform-backend-http-proxy/storage/storagetypes"
+	"time"
+)
+
+// commitStatePullRequest commits the state to the apply branch and opens a pull request for it,
+// instead of pushing to the ref directly. All updates during a single apply (lock) go to the same branch,
+// so the pull request is only opened by the first one.
+func commitStatePullRequest(session *gitSession, params *requestMetadataParams, state []byte, pullRequestForge forge.Forge) error {
+	lockInfo, err := readLockInfo(session, params)
+	if err != nil && !errors.Is(err, storagetypes.ErrLockMissing) {
+		return err
+	}
+
+	if lockInfo == nil {
+		lockInfo = &storagetypes.LockInfo{
+			ID: strconv.FormatInt(time.Now().UnixNano(), 10),
+		}
+	}
+
+	// Updates go on top of the apply branch while its pull request is pending, even those of another apply,
+	// so none of them gets lost once the pull requests are merged
+	applyBranch, err := pendingApplyBranch(session, params)
+	if err != nil {
+		return err
+	}
+
+	pending := applyBranch != ""
+	baseBranch := applyBranch
+	if !pending {
+		applyBranch = getApplyBranchName(params, lockInfo.ID)
+		baseBranch = params.Ref
+	}
+
+	if err := checkoutApplyBranch(session, applyBranch, baseBranch); err != nil {
+		return err
+	}
+
+	if err := writeStateCommit(session, params, state, lockInfo); err != nil {
+		return err
+	}
+
+	applyRef := ref(applyBranch, false)
+
+	if err := session.pushRef(applyBranch, applyRef); err != nil {
+		return err
+	}
+
+	if pending {
+		return nil
+	}
+
+	repository, err := forgeRepository(params.Repository)
+	if err != nil {
+		return err
+	}
+
+	result, err := pullRequestForge.OpenPullRequest(forge.PullRequest{
+		Repository: repository,
+		Head:       applyBranch,
+		Base:       params.Ref,
+		Title:      "Update " + params.State,
+		Body:       pullRequestBody(lockInfo),
+	})
+	if err != nil {
+		// Without a pull request, the apply branch would keep the state locked for good
+		if deleteErr := session.deleteRemoteRef(applyRef); deleteErr != nil {
+			log.Printf("could not delete %s: %s", applyBranch, deleteErr)
+		}
+
+		return err
+	}
+
+	autoMerge, err := autoMergePullRequests()
+	if err != nil || !autoMerge {
+		return err
+	}
+
+	// The state is proposed already, a pull request which can't be merged is left to be merged by hand
+	if err := pullRequestForge.MergePullRequest(repository, result); err != nil {
+		log.Printf("could not merge %s: %s", result.URL, err)
+		return nil
+	}
+
+	// Following updates of the apply will open a new pull request on top of the merged one
+	if err := session.deleteRemoteRef(applyRef); err != nil {
+		log.Printf("could not delete %s: %s", applyBranch, err)
+	}
+
+	return nil
+}
+
+// checkoutApplyBranch checks out the apply branch as a new local branch, reset to the remote base branch.
+func checkoutApplyBranch(session *gitSession, applyBranch, baseBranch string) error {
+	// Delete any local leftovers from the past
+	if err := session.deleteBranch(applyBranch, false); err != nil {
+		return err
+	}
+
+	if err := session.checkout(applyBranch, checkoutModeCreate); err != nil {
+		return err
+	}
+
+	_, err := session.resetToRemote(baseBranch)
+	return err
+}
+
+// checkoutPendingApply checks out the apply branch in pull request mode while its pull request is pending,
+// so the state is read the way the apply left it rather than the way it was before.
+func checkoutPendingApply(session *gitSession, params *requestMetadataParams) error {
+	pullRequestForge, err := forge.GetForge()
+	if err != nil || pullRequestForge == nil {
+		return err
+	}
+
+	applyBranch, err := pendingApplyBranch(session, params)
+	if err != nil || applyBranch == "" {
+		return err
+	}
+
+	return checkoutApplyBranch(session, applyBranch, applyBranch)
+}
+
+// pendingApplyLock describes the apply branch in pull request mode as the lock of the state while its pull request is pending,
+// so no one applies on top of the outdated ref in the meantime. It fails with storagetypes.ErrLockMissing if there is none.
+func pendingApplyLock(session *gitSession, params *requestMetadataParams) (*storagetypes.LockInfo, error) {
+	pullRequestForge, err := forge.GetForge()
+	if err != nil {
+		return nil, err
+	}
+
+	if pullRequestForge == nil {
+		return nil, storagetypes.ErrLockMissing
+	}
+
+	applyBranch, err := pendingApplyBranch(session, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if applyBranch == "" {
+		return nil, storagetypes.ErrLockMissing
+	}
+
+	head, err := session.repository.Reference(ref(applyBranch, true), true)
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := session.repository.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	return &storagetypes.LockInfo{
+		ID:      strings.TrimPrefix(applyBranch, getApplyBranchName(params, "")),
+		Info:    "The pull request of " + applyBranch + " isn't merged yet",
+		Who:     commit.Author.Email,
+		Created: commit.Committer.When,
+		Path:    params.State,
+	}, nil
+}
+
+// pendingApplyBranch is the apply branch of the state which pull request isn't merged yet, empty if there is none.
+// Pull requests count as merged once the ref holds the same state as their apply branch, which also covers squash merges.
+// Apply branches of merged pull requests are deleted on the way, in case the forge didn't.
+func pendingApplyBranch(session *gitSession, params *requestMetadataParams) (string, error) {
+	refs, err := session.remoteRefs()
+	if err != nil {
+		return "", err
+	}
+
+	merged, err := session.stateHash(params.Ref, params.State)
+	if err != nil {
+		return "", err
+	}
+
+	prefix := ref(getApplyBranchName(params, ""), false).String()
+
+	var pending []string
+	for _, reference := range refs {
+		lockID := strings.TrimPrefix(reference.Name().String(), prefix)
+
+		// Apply branches of states nested below this one have a longer path
+		if lockID == reference.Name().String() || strings.Contains(lockID, "/") {
+			continue
+		}
+
+		applyBranch := getApplyBranchName(params, lockID)
+
+		state, err := session.stateHash(applyBranch, params.State)
+		if err != nil {
+			return "", err
+		}
+
+		if state != merged {
+			pending = append(pending, applyBranch)
+			continue
+		}
+
+		if err := session.deleteRemoteRefAt(reference); err != nil {
+			log.Printf("could not delete merged %s: %s", applyBranch, err)
+		}
+	}
+
+	if len(pending) > 1 {
+		return "", fmt.Errorf("several pull requests of %s are pending: %s", params.State, strings.Join(pending, ", "))
+	}
+
+	if len(pending) == 0 {
+		return "", nil
+	}
+
+	return pending[0], nil
+}
+
+// stateHash fetches the branch and returns the hash of the state committed there, the zero hash if there is none.
+func (gitSession *gitSession) stateHash(branch, path string) (plumbing.Hash, error) {
+	remoteRef := ref(branch, true)
+
+	refSpecs := []config.RefSpec{
+		config.RefSpec("+" + ref(branch, false) + ":" + remoteRef),
+	}
+
+	if err := gitSession.fetch(refSpecs); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	reference, err := gitSession.repository.Reference(remoteRef, true)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	commit, err := gitSession.repository.CommitObject(reference.Hash())
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	file, err := commit.File(path)
+	if err != nil {
+		if errors.Is(err, object.ErrFileNotFound) {
+			return plumbing.ZeroHash, nil
+		}
+		return plumbing.ZeroHash, err
+	}
+
+	return file.Hash, nil
+}
+
+// autoMergePullRequests returns if pull requests are merged right after opening them,
+// configured with TF_BACKEND_HTTP_GIT_PULL_REQUEST_AUTO_MERGE.
+func autoMergePullRequests() (bool, error) {
+	autoMerge, ok := os.LookupEnv("TF_BACKEND_HTTP_GIT_PULL_REQUEST_AUTO_MERGE")
+	if !ok {
+		return false, nil
+	}
+
+	return strconv.ParseBool(autoMerge)
+}
+
+// forgeRepository is the path of the repository on the forge, e.g. org/repo.
+func forgeRepository(repository string) (string, error) {
+	endpoint, err := transport.NewEndpoint(repository)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(strings.Trim(endpoint.Path, "/"), ".git"), nil
+}
+
+// getApplyBranchName is the branch state updates of a single apply are pushed to in pull request mode.
+func getApplyBranchName(params *requestMetadataParams, lockID string) string {
+	return "tf-apply/" + params.State + "/" + lockID
+}
+
+func pullRequestBody(lockInfo *storagetypes.LockInfo) string {
+	return fmt.Sprintf(`Terraform state update by the HTTP backend proxy.
+
+| Lock      |     |
+|-----------|-----|
+| ID        | %s |
+| Operation | %s |
+| Who       | %s |
+| Version   | %s |
+| Info      | %s |
+`, lockInfo.ID, lockInfo.Operation, lockInfo.Who, lockInfo.Version, lockInfo.Info)
+}
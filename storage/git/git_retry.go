@@ -0,0 +1,67 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// errRemoteChanged indicates that a push was rejected because the remote ref moved in the meantime.
+var errRemoteChanged = errors.New("remote ref changed while pushing")
+
+// defaultPushAttempts is how many times a rejected push is attempted in total.
+const defaultPushAttempts = 3
+
+// defaultPushBackoff is the delay before the first retry, doubled for every following retry.
+const defaultPushBackoff = time.Second
+
+// pushRetryConfig returns the attempts and initial backoff for pushes rejected due to remote changes.
+// They're configured with TF_BACKEND_HTTP_GIT_PUSH_ATTEMPTS and TF_BACKEND_HTTP_GIT_PUSH_BACKOFF.
+func pushRetryConfig() (int, time.Duration, error) {
+	attempts := defaultPushAttempts
+	if a, ok := os.LookupEnv("TF_BACKEND_HTTP_GIT_PUSH_ATTEMPTS"); ok {
+		parsed, err := strconv.Atoi(a)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if parsed < 1 {
+			return 0, 0, fmt.Errorf("invalid push attempts %d", parsed)
+		}
+
+		attempts = parsed
+	}
+
+	backoff := defaultPushBackoff
+	if b, ok := os.LookupEnv("TF_BACKEND_HTTP_GIT_PUSH_BACKOFF"); ok {
+		parsed, err := time.ParseDuration(b)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		backoff = parsed
+	}
+
+	return attempts, backoff, nil
+}
+
+// retryOnRemoteChange calls fn until it succeeds or fails with an error other than errRemoteChanged.
+// Retries are bounded and backed off exponentially as configured by pushRetryConfig.
+func retryOnRemoteChange(fn func() error) error {
+	attempts, backoff, err := pushRetryConfig()
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !errors.Is(err, errRemoteChanged) || attempt >= attempts {
+			return err
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,204 @@
+package git
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sessionConfig configures how long sessions are kept and if they're kept up to date in the background.
+type sessionConfig struct {
+	// ttl is how long idle sessions are kept, configured with TF_BACKEND_HTTP_GIT_SESSION_TTL. 0 keeps them forever.
+	ttl time.Duration
+
+	// maxSessions limits the number of sessions, configured with TF_BACKEND_HTTP_GIT_MAX_SESSIONS. 0 means unlimited.
+	// The least recently used idle session is evicted to make room for a new one.
+	maxSessions int
+
+	// fetchInterval is how often sessions are fetched in the background, configured with TF_BACKEND_HTTP_GIT_FETCH_INTERVAL.
+	// 0 disables background fetching.
+	fetchInterval time.Duration
+}
+
+func loadSessionConfig() (*sessionConfig, error) {
+	config := &sessionConfig{}
+
+	if ttl, ok := os.LookupEnv("TF_BACKEND_HTTP_GIT_SESSION_TTL"); ok {
+		parsed, err := time.ParseDuration(ttl)
+		if err != nil {
+			return nil, err
+		}
+
+		config.ttl = parsed
+	}
+
+	if maxSessions, ok := os.LookupEnv("TF_BACKEND_HTTP_GIT_MAX_SESSIONS"); ok {
+		parsed, err := strconv.Atoi(maxSessions)
+		if err != nil {
+			return nil, err
+		}
+
+		if parsed < 0 {
+			return nil, fmt.Errorf("invalid max sessions %d", parsed)
+		}
+
+		config.maxSessions = parsed
+	}
+
+	if interval, ok := os.LookupEnv("TF_BACKEND_HTTP_GIT_FETCH_INTERVAL"); ok {
+		parsed, err := time.ParseDuration(interval)
+		if err != nil {
+			return nil, err
+		}
+
+		config.fetchInterval = parsed
+	}
+
+	return config, nil
+}
+
+// startSessionMaintenance starts evicting expired sessions and fetching in the background, if configured.
+// Invalid configuration is reported by getSession instead.
+func (client *StorageClient) startSessionMaintenance() {
+	config, err := loadSessionConfig()
+	if err != nil {
+		return
+	}
+
+	period := config.fetchInterval
+	if period <= 0 || (config.ttl > 0 && config.ttl < period) {
+		period = config.ttl
+	}
+
+	if period <= 0 {
+		return
+	}
+
+	go func() {
+		for range time.Tick(period) {
+			client.evictExpiredSessions(config.ttl)
+
+			if config.fetchInterval > 0 {
+				client.fetchSessions()
+			}
+		}
+	}()
+}
+
+// evictExpiredSessions drops sessions idle for longer than ttl.
+func (client *StorageClient) evictExpiredSessions(ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	client.sessionsMutex.Lock()
+	defer client.sessionsMutex.Unlock()
+
+	for key, session := range client.sessions {
+		if session.users == 0 && time.Since(session.lastUsed) > ttl {
+			delete(client.sessions, key)
+		}
+	}
+}
+
+// evictForNewSession drops the least recently used idle sessions until there's room for a new one.
+// If all sessions are in use, the limit is exceeded until some of them become idle.
+// The sessionsMutex must be locked by the caller.
+func (client *StorageClient) evictForNewSession() error {
+	config, err := loadSessionConfig()
+	if err != nil {
+		return err
+	}
+
+	if config.maxSessions == 0 {
+		return nil
+	}
+
+	for len(client.sessions) >= config.maxSessions {
+		var lruKey string
+		var lru *gitSession
+
+		for key, session := range client.sessions {
+			if session.users == 0 && (lru == nil || session.lastUsed.Before(lru.lastUsed)) {
+				lruKey = key
+				lru = session
+			}
+		}
+
+		if lru == nil {
+			return nil
+		}
+
+		delete(client.sessions, lruKey)
+	}
+
+	return nil
+}
+
+// fetchSessions fetches the remote of every session, so requests find them up to date.
+func (client *StorageClient) fetchSessions() {
+	// Sessions are held without touching lastUsed, background fetches don't keep sessions from expiring
+	client.sessionsMutex.Lock()
+	sessions := make(map[string]*gitSession, len(client.sessions))
+	for key, session := range client.sessions {
+		session.users++
+		sessions[key] = session
+	}
+	client.sessionsMutex.Unlock()
+
+	for key, session := range sessions {
+		session.mutex.Lock()
+
+		// Fetch using the refspecs configured for origin when the clone was made
+		if err := session.fetch(nil); err != nil {
+			log.Printf("background fetch of %s failed: %s", key, err)
+		} else {
+			session.fetched = time.Now()
+		}
+
+		session.mutex.Unlock()
+
+		client.sessionsMutex.Lock()
+		session.users--
+		client.sessionsMutex.Unlock()
+	}
+}
+
+// fetchedRecently returns if the session was fetched in the background within the last two fetch intervals,
+// in which case reading from it without fetching again is considered up to date.
+// The session must be locked by the caller.
+func (gitSession *gitSession) fetchedRecently() (bool, error) {
+	config, err := loadSessionConfig()
+	if err != nil {
+		return false, err
+	}
+
+	if config.fetchInterval <= 0 || gitSession.fetched.IsZero() {
+		return false, nil
+	}
+
+	return time.Since(gitSession.fetched) < 2*config.fetchInterval, nil
+}
+
+// staleReadAllowed returns if the state can be read as fetched in the background, which might be outdated.
+// That's only the case for read-only access to unlocked states. Whoever holds the lock is about to update the state
+// and must not replace a newer state with one based on an outdated one. The session must be locked by the caller.
+func (gitSession *gitSession) staleReadAllowed(params *requestMetadataParams) (bool, error) {
+	if params.lockID != "" {
+		return false, nil
+	}
+
+	fetchedRecently, err := gitSession.fetchedRecently()
+	if err != nil || !fetchedRecently {
+		return false, err
+	}
+
+	locked, err := gitSession.isLocked(params)
+	if err != nil {
+		return false, err
+	}
+
+	return !locked, nil
+}
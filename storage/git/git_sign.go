@@ -0,0 +1,264 @@
+package git
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/go-git/go-git/v5/plumbing"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"os"
+	"strings"
+)
+
+// signingKey is the key commits and tags are signed with.
+// OpenPGP signatures are created by go-git itself, only the SSH signature format is implemented here.
+type signingKey struct {
+	// pgp is passed to go-git as the SignKey of commits and tags, it's nil for SSH keys
+	pgp *openpgp.Entity
+
+	// ssh signs objects after go-git created them, it's nil for OpenPGP keys
+	ssh *sshSigner
+}
+
+// loadSigningKey loads the key configured with TF_BACKEND_HTTP_GIT_SIGNING_KEY (path to the private key)
+// and TF_BACKEND_HTTP_GIT_SIGNING_KEY_PASSPHRASE. TF_BACKEND_HTTP_GIT_SIGNING_FORMAT selects between
+// "openpgp" (default) and "ssh" keys, same as gpg.format in git.
+// It returns nil if commits shouldn't be signed.
+func loadSigningKey() (*signingKey, error) {
+	keyFile, ok := os.LookupEnv("TF_BACKEND_HTTP_GIT_SIGNING_KEY")
+	if !ok {
+		return nil, nil
+	}
+
+	key, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	passphrase := os.Getenv("TF_BACKEND_HTTP_GIT_SIGNING_KEY_PASSPHRASE")
+
+	format := os.Getenv("TF_BACKEND_HTTP_GIT_SIGNING_FORMAT")
+	switch format {
+	case "", "openpgp":
+		entity, err := readPGPKey(key, passphrase)
+		if err != nil {
+			return nil, err
+		}
+
+		return &signingKey{pgp: entity}, nil
+	case "ssh":
+		signer, err := newSSHSigner(key, passphrase)
+		if err != nil {
+			return nil, err
+		}
+
+		return &signingKey{ssh: signer}, nil
+	}
+
+	return nil, fmt.Errorf("unknown signing format %q", format)
+}
+
+// pgpKey returns the key go-git signs with, nil if there's none.
+func (key *signingKey) pgpKey() *openpgp.Entity {
+	if key == nil {
+		return nil
+	}
+
+	return key.pgp
+}
+
+// signCommitSSH replaces the commit at HEAD with a copy of it signed by the SSH key.
+// The branch HEAD points to is moved along, so the signed commit is what gets pushed.
+func (gitSession *gitSession) signCommitSSH(hash plumbing.Hash, signer *sshSigner) error {
+	commit, err := gitSession.repository.CommitObject(hash)
+	if err != nil {
+		return err
+	}
+
+	signature, err := signObject(commit.EncodeWithoutSignature, signer)
+	if err != nil {
+		return err
+	}
+
+	commit.PGPSignature = signature
+
+	signedHash, err := gitSession.storeObject(commit.Encode)
+	if err != nil {
+		return err
+	}
+
+	head, err := gitSession.repository.Head()
+	if err != nil {
+		return err
+	}
+
+	return gitSession.repository.Storer.SetReference(plumbing.NewHashReference(head.Name(), signedHash))
+}
+
+// signTagSSH replaces the annotated tag with a copy of it signed by the SSH key.
+func (gitSession *gitSession) signTagSSH(tagRef *plumbing.Reference, signer *sshSigner) error {
+	tag, err := gitSession.repository.TagObject(tagRef.Hash())
+	if err != nil {
+		return err
+	}
+
+	if tag.PGPSignature, err = signObject(tag.EncodeWithoutSignature, signer); err != nil {
+		return err
+	}
+
+	signedHash, err := gitSession.storeObject(tag.Encode)
+	if err != nil {
+		return err
+	}
+
+	return gitSession.repository.Storer.SetReference(plumbing.NewHashReference(tagRef.Name(), signedHash))
+}
+
+// signObject signs the object as encoded without its signature, which is what git verifies the signature against.
+func signObject(encodeWithoutSignature func(plumbing.EncodedObject) error, signer *sshSigner) (string, error) {
+	unsigned := &plumbing.MemoryObject{}
+	if err := encodeWithoutSignature(unsigned); err != nil {
+		return "", err
+	}
+
+	reader, err := unsigned.Reader()
+	if err != nil {
+		return "", err
+	}
+
+	return signer.sign(reader)
+}
+
+// storeObject encodes an object into the storage.
+func (gitSession *gitSession) storeObject(encode func(plumbing.EncodedObject) error) (plumbing.Hash, error) {
+	obj := gitSession.repository.Storer.NewEncodedObject()
+	if err := encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	return gitSession.repository.Storer.SetEncodedObject(obj)
+}
+
+// readPGPKey reads the OpenPGP private key, decrypting it as go-git requires.
+func readPGPKey(armoredKey []byte, passphrase string) (*openpgp.Entity, error) {
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(armoredKey))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entities) == 0 || entities[0].PrivateKey == nil {
+		return nil, errors.New("signing key does not contain an OpenPGP private key")
+	}
+
+	entity := entities[0]
+
+	if entity.PrivateKey.Encrypted {
+		if err := entity.PrivateKey.Decrypt([]byte(passphrase)); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, subkey := range entity.Subkeys {
+		if subkey.PrivateKey != nil && subkey.PrivateKey.Encrypted {
+			if err := subkey.PrivateKey.Decrypt([]byte(passphrase)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return entity, nil
+}
+
+// sshSigner signs commits with an SSH key in the format of `ssh-keygen -Y sign -n git`.
+// See https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.sshsig.
+type sshSigner struct {
+	signer ssh.Signer
+}
+
+const (
+	sshSigMagic     = "SSHSIG"
+	sshSigVersion   = 1
+	sshSigNamespace = "git"
+	sshSigHashAlgo  = "sha512"
+)
+
+func newSSHSigner(privateKey []byte, passphrase string) (*sshSigner, error) {
+	var signer ssh.Signer
+	var err error
+
+	if passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(privateKey, []byte(passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(privateKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &sshSigner{signer: signer}, nil
+}
+
+func (signer *sshSigner) sign(message io.Reader) (string, error) {
+	hash := sha512.New()
+	if _, err := io.Copy(hash, message); err != nil {
+		return "", err
+	}
+
+	var signedData bytes.Buffer
+	signedData.WriteString(sshSigMagic)
+	writeSSHString(&signedData, []byte(sshSigNamespace))
+	writeSSHString(&signedData, nil)
+	writeSSHString(&signedData, []byte(sshSigHashAlgo))
+	writeSSHString(&signedData, hash.Sum(nil))
+
+	signature, err := signer.signData(signedData.Bytes())
+	if err != nil {
+		return "", err
+	}
+
+	var blob bytes.Buffer
+	blob.WriteString(sshSigMagic)
+	_ = binary.Write(&blob, binary.BigEndian, uint32(sshSigVersion))
+	writeSSHString(&blob, signer.signer.PublicKey().Marshal())
+	writeSSHString(&blob, []byte(sshSigNamespace))
+	writeSSHString(&blob, nil)
+	writeSSHString(&blob, []byte(sshSigHashAlgo))
+	writeSSHString(&blob, ssh.Marshal(signature))
+
+	return armorSSHSignature(blob.Bytes()), nil
+}
+
+// signData signs with SHA-512 for RSA keys, since plain ssh-rsa (SHA-1) signatures are rejected by ssh-keygen.
+func (signer *sshSigner) signData(data []byte) (*ssh.Signature, error) {
+	if algorithmSigner, ok := signer.signer.(ssh.AlgorithmSigner); ok && signer.signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		return algorithmSigner.SignWithAlgorithm(rand.Reader, data, ssh.KeyAlgoRSASHA512)
+	}
+
+	return signer.signer.Sign(rand.Reader, data)
+}
+
+func writeSSHString(buf *bytes.Buffer, value []byte) {
+	_ = binary.Write(buf, binary.BigEndian, uint32(len(value)))
+	buf.Write(value)
+}
+
+func armorSSHSignature(blob []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(blob)
+
+	var armored strings.Builder
+	armored.WriteString("-----BEGIN SSH SIGNATURE-----\n")
+	for len(encoded) > 70 {
+		armored.WriteString(encoded[:70] + "\n")
+		encoded = encoded[70:]
+	}
+	armored.WriteString(encoded + "\n")
+	armored.WriteString("-----END SSH SIGNATURE-----\n")
+
+	return armored.String()
+}
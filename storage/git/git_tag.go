@@ -0,0 +1,153 @@
+package git
+
+import (
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"os"
+	"strconv"
+	"strings"
+	"terraform-backend-http-proxy/storage/storagetypes"
+	"time"
+)
+
+// tagUpdates returns if every state update is tagged, configured with TF_BACKEND_HTTP_GIT_TAG_UPDATES.
+func tagUpdates() (bool, error) {
+	tag, ok := os.LookupEnv("TF_BACKEND_HTTP_GIT_TAG_UPDATES")
+	if !ok {
+		return false, nil
+	}
+
+	return strconv.ParseBool(tag)
+}
+
+// getStateTagRef is the tag for the state update committed as commit, e.g. refs/tags/state/<path>/<lineage>/serial-<n>.
+// Serials start over with every new lineage, so they're only unique within it.
+// States which serial isn't known, e.g. since they're no Terraform states, are tagged by the commit instead.
+func getStateTagRef(params *requestMetadataParams, commit plumbing.Hash) plumbing.ReferenceName {
+	version := "commit-" + commit.String()
+	if update := params.update; update != nil && update.Serial != nil {
+		version = "serial-" + strconv.FormatUint(*update.Serial, 10)
+
+		if update.Lineage != "" {
+			version = update.Lineage + "/" + version
+		}
+	}
+
+	return plumbing.ReferenceName("refs/tags/state/" + params.State + "/" + version)
+}
+
+// tagState creates an annotated tag for the commit at HEAD and pushes it.
+// The tag message describes the lock the update was done under, it might be nil if unknown.
+// Tags already on the remote are kept as they are, so they remain stable references.
+// It fails if such a tag was created for another commit, e.g. since the same serial was pushed twice.
+func (gitSession *gitSession) tagState(params *requestMetadataParams, lockInfo *storagetypes.LockInfo) error {
+	head, err := gitSession.repository.Head()
+	if err != nil {
+		return err
+	}
+
+	tagRef := getStateTagRef(params, head.Hash())
+
+	existing, err := gitSession.remoteRef(tagRef)
+	if err != nil {
+		return err
+	}
+
+	if existing != nil {
+		return gitSession.checkTagTarget(existing, head.Hash())
+	}
+
+	key, err := loadSigningKey()
+	if err != nil {
+		return err
+	}
+
+	// Leftovers of a tag which didn't make it to the remote are replaced
+	if err := gitSession.repository.Storer.RemoveReference(tagRef); err != nil {
+		return err
+	}
+
+	committer := committerDetails()
+
+	tagOptions := git.CreateTagOptions{
+		Tagger: &object.Signature{
+			Name:  committer.name,
+			Email: committer.email,
+			When:  time.Now(),
+		},
+		Message: stateTagMessage(params, lockInfo),
+		SignKey: key.pgpKey(),
+	}
+
+	tag, err := gitSession.repository.CreateTag(strings.TrimPrefix(tagRef.String(), "refs/tags/"), head.Hash(), &tagOptions)
+	if err != nil {
+		return err
+	}
+
+	if key != nil && key.ssh != nil {
+		if err := gitSession.signTagSSH(tag, key.ssh); err != nil {
+			return err
+		}
+	}
+
+	remote, err := gitSession.getRemote()
+	if err != nil {
+		return err
+	}
+
+	pushOptions := git.PushOptions{
+		RefSpecs: []config.RefSpec{
+			config.RefSpec(tagRef + ":" + tagRef),
+		},
+		Auth: gitSession.auth,
+	}
+
+	return remote.Push(&pushOptions)
+}
+
+// checkTagTarget fails if the annotated tag on the remote doesn't point to the commit.
+func (gitSession *gitSession) checkTagTarget(tagRef *plumbing.Reference, commit plumbing.Hash) error {
+	refSpecs := []config.RefSpec{
+		config.RefSpec("+" + tagRef.Name() + ":" + tagRef.Name()),
+	}
+
+	if err := gitSession.fetch(refSpecs); err != nil {
+		return err
+	}
+
+	tag, err := gitSession.repository.TagObject(tagRef.Hash())
+	if err != nil {
+		return err
+	}
+
+	if tag.Target != commit {
+		return fmt.Errorf("tag %s already exists for commit %s", tagRef.Name().Short(), tag.Target)
+	}
+
+	return nil
+}
+
+// stateTagMessage describes the update with the details of the lock it was done under.
+func stateTagMessage(params *requestMetadataParams, lockInfo *storagetypes.LockInfo) string {
+	var message strings.Builder
+	message.WriteString("Update " + params.State + "\n")
+
+	if params.update != nil && params.update.Serial != nil {
+		message.WriteString("\n")
+		fmt.Fprintf(&message, "Serial: %d\n", *params.update.Serial)
+		fmt.Fprintf(&message, "Lineage: %s\n", params.update.Lineage)
+	}
+
+	if lockInfo != nil {
+		message.WriteString("\n")
+		fmt.Fprintf(&message, "Operation: %s\n", lockInfo.Operation)
+		fmt.Fprintf(&message, "Who: %s\n", lockInfo.Who)
+		fmt.Fprintf(&message, "Version: %s\n", lockInfo.Version)
+		fmt.Fprintf(&message, "Info: %s\n", lockInfo.Info)
+	}
+
+	return message.String()
+}
@@ -0,0 +1,23 @@
+package git
+
+import (
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/plumbing/transport/server"
+)
+
+func init() {
+	// Serve local and file:// repositories in-process instead of spawning
+	// git-upload-pack and git-receive-pack, so no git binary is required.
+	client.InstallProtocol("file", server.DefaultServer)
+}
+
+// isLocalRepository reports whether the repository is a local path or file:// URL.
+func isLocalRepository(repository string) bool {
+	endpoint, err := transport.NewEndpoint(repository)
+	if err != nil {
+		return false
+	}
+
+	return endpoint.Protocol == "file"
+}
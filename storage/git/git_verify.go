@@ -0,0 +1,235 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"golang.org/x/crypto/ssh"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"terraform-backend-http-proxy/storage/storagetypes"
+)
+
+// signatureVerifier verifies commit signatures against the configured trusted keys.
+// Trusted OpenPGP keys are read from the armored keyring in TF_BACKEND_HTTP_GIT_VERIFY_PGP_KEYRING
+// and trusted SSH keys from the allowed signers file in TF_BACKEND_HTTP_GIT_VERIFY_SSH_ALLOWED_SIGNERS.
+type signatureVerifier struct {
+	pgpKeyRing    string
+	sshSignerKeys []ssh.PublicKey
+}
+
+// loadSignatureVerifier returns nil if signatures shouldn't be verified.
+func loadSignatureVerifier() (*signatureVerifier, error) {
+	keyRingFile, okKeyRing := os.LookupEnv("TF_BACKEND_HTTP_GIT_VERIFY_PGP_KEYRING")
+	allowedSignersFile, okAllowedSigners := os.LookupEnv("TF_BACKEND_HTTP_GIT_VERIFY_SSH_ALLOWED_SIGNERS")
+
+	if !okKeyRing && !okAllowedSigners {
+		return nil, nil
+	}
+
+	verifier := &signatureVerifier{}
+
+	if okKeyRing {
+		keyRing, err := os.ReadFile(keyRingFile)
+		if err != nil {
+			return nil, err
+		}
+
+		verifier.pgpKeyRing = string(keyRing)
+	}
+
+	if okAllowedSigners {
+		keys, err := readAllowedSigners(allowedSignersFile)
+		if err != nil {
+			return nil, err
+		}
+
+		verifier.sshSignerKeys = keys
+	}
+
+	return verifier, nil
+}
+
+// verifyState verifies the signature of the last commit touching path at HEAD.
+// Nothing is verified if no commit touched the path at all.
+func (gitSession *gitSession) verifyState(path string, verifier *signatureVerifier) error {
+	commits, err := gitSession.stateLog(path)
+	if err != nil {
+		return err
+	}
+	defer commits.Close()
+
+	var last *object.Commit
+	err = commits.ForEach(func(commit *object.Commit) error {
+		last = commit
+		return storer.ErrStop
+	})
+	if err != nil {
+		return err
+	}
+
+	if last == nil {
+		return nil
+	}
+
+	if err := verifier.verify(last); err != nil {
+		return fmt.Errorf("%w: commit %s: %s", storagetypes.ErrUntrustedState, last.Hash, err)
+	}
+
+	return nil
+}
+
+func (verifier *signatureVerifier) verify(commit *object.Commit) error {
+	switch {
+	case commit.PGPSignature == "":
+		return errors.New("commit is not signed")
+	case strings.HasPrefix(commit.PGPSignature, "-----BEGIN SSH SIGNATURE-----"):
+		return verifier.verifySSH(commit)
+	}
+
+	if verifier.pgpKeyRing == "" {
+		return errors.New("no trusted OpenPGP keys configured")
+	}
+
+	_, err := commit.Verify(verifier.pgpKeyRing)
+	return err
+}
+
+// sshSignatureBlob is the signature blob following the SSHSIG preamble.
+// See https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.sshsig.
+type sshSignatureBlob struct {
+	Version   uint32
+	PublicKey []byte
+	Namespace string
+	Reserved  string
+	HashAlgo  string
+	Signature []byte
+}
+
+func (verifier *signatureVerifier) verifySSH(commit *object.Commit) error {
+	armored := strings.TrimSpace(commit.PGPSignature)
+	armored = strings.TrimPrefix(armored, "-----BEGIN SSH SIGNATURE-----")
+	armored = strings.TrimSuffix(armored, "-----END SSH SIGNATURE-----")
+
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(armored), ""))
+	if err != nil {
+		return err
+	}
+
+	if !bytes.HasPrefix(raw, []byte(sshSigMagic)) {
+		return errors.New("malformed ssh signature")
+	}
+
+	var blob sshSignatureBlob
+	if err := ssh.Unmarshal(raw[len(sshSigMagic):], &blob); err != nil {
+		return err
+	}
+
+	if blob.Version != sshSigVersion || blob.Namespace != sshSigNamespace {
+		return errors.New("unsupported ssh signature")
+	}
+
+	publicKey, err := ssh.ParsePublicKey(blob.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	if !verifier.isAllowedSigner(publicKey) {
+		return fmt.Errorf("ssh key %s is not an allowed signer", ssh.FingerprintSHA256(publicKey))
+	}
+
+	var signature ssh.Signature
+	if err := ssh.Unmarshal(blob.Signature, &signature); err != nil {
+		return err
+	}
+
+	var h hash.Hash
+	switch blob.HashAlgo {
+	case "sha512":
+		h = sha512.New()
+	case "sha256":
+		h = sha256.New()
+	default:
+		return fmt.Errorf("unsupported ssh signature hash %q", blob.HashAlgo)
+	}
+
+	unsigned := &plumbing.MemoryObject{}
+	if err := commit.EncodeWithoutSignature(unsigned); err != nil {
+		return err
+	}
+
+	reader, err := unsigned.Reader()
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(h, reader); err != nil {
+		return err
+	}
+
+	var signedData bytes.Buffer
+	signedData.WriteString(sshSigMagic)
+	writeSSHString(&signedData, []byte(blob.Namespace))
+	writeSSHString(&signedData, []byte(blob.Reserved))
+	writeSSHString(&signedData, []byte(blob.HashAlgo))
+	writeSSHString(&signedData, h.Sum(nil))
+
+	return publicKey.Verify(signedData.Bytes(), &signature)
+}
+
+func (verifier *signatureVerifier) isAllowedSigner(publicKey ssh.PublicKey) bool {
+	for _, key := range verifier.sshSignerKeys {
+		if bytes.Equal(key.Marshal(), publicKey.Marshal()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readAllowedSigners reads the keys of an allowed signers file as used by gpg.ssh.allowedSignersFile.
+// Each line lists the principals followed by an authorized_keys entry, which principal signed is not checked.
+func readAllowedSigners(path string) ([]ssh.PublicKey, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var keys []ssh.PublicKey
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		principalsEnd := strings.IndexAny(line, " \t")
+		if principalsEnd < 0 {
+			return nil, fmt.Errorf("malformed allowed signers line %q", line)
+		}
+
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line[principalsEnd+1:]))
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
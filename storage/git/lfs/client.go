@@ -0,0 +1,210 @@
+package lfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// mediaType is what the LFS API expects and responds with
+const mediaType = "application/vnd.git-lfs+json"
+
+// Client transfers objects through the LFS batch API using the basic transfer adapter.
+// See https://github.com/git-lfs/git-lfs/blob/main/docs/api/batch.md.
+type Client struct {
+	// url is the LFS server URL, e.g. https://github.com/org/repo.git/info/lfs
+	url string
+
+	// username and password are sent as basic auth to the LFS server, if username is set
+	username, password string
+
+	// httpClient sends the requests, each of them has to finish within the timeout
+	httpClient *http.Client
+}
+
+// NewClient creates a client for the LFS server at url.
+// Requests taking longer than the timeout fail, so a server which hangs doesn't block the caller forever.
+func NewClient(url, username, password string, timeout time.Duration) *Client {
+	return &Client{
+		url:      strings.TrimSuffix(url, "/"),
+		username: username,
+		password: password,
+		httpClient: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+type batchObject struct {
+	OID     string                  `json:"oid"`
+	Size    int64                   `json:"size"`
+	Actions map[string]*batchAction `json:"actions,omitempty"`
+	Error   *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+type batchAction struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header"`
+}
+
+// Upload stores the contents on the LFS server and returns the pointer to commit in their place.
+// Nothing is transferred if the server already has the object.
+func (client *Client) Upload(contents []byte) (*Pointer, error) {
+	pointer := NewPointer(contents)
+
+	object, err := client.batch("upload", pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	upload, ok := object.Actions["upload"]
+	if !ok {
+		return pointer, nil
+	}
+
+	if _, err := client.transfer(http.MethodPut, upload, "application/octet-stream", contents); err != nil {
+		return nil, err
+	}
+
+	if verify, ok := object.Actions["verify"]; ok {
+		body, err := json.Marshal(map[string]interface{}{
+			"oid":  pointer.OID,
+			"size": pointer.Size,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := client.transfer(http.MethodPost, verify, mediaType, body); err != nil {
+			return nil, err
+		}
+	}
+
+	return pointer, nil
+}
+
+// Download fetches the contents the pointer refers to from the LFS server.
+func (client *Client) Download(pointer *Pointer) ([]byte, error) {
+	object, err := client.batch("download", pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	download, ok := object.Actions["download"]
+	if !ok {
+		return nil, fmt.Errorf("lfs object %s can't be downloaded", pointer.OID)
+	}
+
+	contents, err := client.transfer(http.MethodGet, download, "", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(contents)
+	if hex.EncodeToString(sum[:]) != pointer.OID {
+		return nil, fmt.Errorf("lfs object %s is corrupt", pointer.OID)
+	}
+
+	return contents, nil
+}
+
+// batch requests the actions to transfer the object for the operation, either upload or download.
+func (client *Client) batch(operation string, pointer *Pointer) (*batchObject, error) {
+	payload := map[string]interface{}{
+		"operation": operation,
+		"transfers": []string{"basic"},
+		"objects": []batchObject{{
+			OID:  pointer.OID,
+			Size: pointer.Size,
+		}},
+		"hash_algo": "sha256",
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, client.url+"/objects/batch", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", mediaType)
+	req.Header.Set("Accept", mediaType)
+	if client.username != "" {
+		req.SetBasicAuth(client.username, client.password)
+	}
+
+	res, err := client.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		message, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("lfs batch %s: %s: %s", operation, res.Status, message)
+	}
+
+	var batch struct {
+		Objects []*batchObject `json:"objects"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&batch); err != nil {
+		return nil, err
+	}
+
+	if len(batch.Objects) != 1 || batch.Objects[0].OID != pointer.OID {
+		return nil, fmt.Errorf("lfs batch %s: no response for object %s", operation, pointer.OID)
+	}
+
+	object := batch.Objects[0]
+	if object.Error != nil {
+		return nil, fmt.Errorf("lfs batch %s: object %s: %d %s", operation, pointer.OID, object.Error.Code, object.Error.Message)
+	}
+
+	return object, nil
+}
+
+// transfer calls the action returned by the batch API, the headers given by the action take care of authentication.
+func (client *Client) transfer(method string, action *batchAction, contentType string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, action.Href, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	for key, value := range action.Header {
+		req.Header.Set(key, value)
+	}
+
+	res, err := client.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	contents, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= 300 {
+		return nil, fmt.Errorf("lfs %s %s: %s: %s", method, action.Href, res.Status, contents)
+	}
+
+	return contents, nil
+}
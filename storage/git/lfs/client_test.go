@@ -0,0 +1,271 @@
+package lfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lfsServer is a stand-in LFS server implementing the batch API with the basic transfer adapter.
+type lfsServer struct {
+	*httptest.Server
+
+	mutex sync.Mutex
+
+	// objects are the stored contents by OID
+	objects map[string][]byte
+
+	// verify makes the batch API request verifying uploads
+	verify bool
+
+	// verified are the OIDs verified after uploading them
+	verified []string
+
+	// uploads counts the upload transfers
+	uploads int
+
+	// corrupt makes downloads return other contents than requested
+	corrupt bool
+}
+
+func newLFSServer(t *testing.T) *lfsServer {
+	server := &lfsServer{
+		objects: make(map[string][]byte),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/objects/batch", server.batch)
+	mux.HandleFunc("/upload/", server.upload)
+	mux.HandleFunc("/verify", server.verifyUpload)
+	mux.HandleFunc("/download/", server.download)
+
+	server.Server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func (server *lfsServer) batch(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Content-Type") != mediaType {
+		http.Error(w, "unexpected content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var request struct {
+		Operation string        `json:"operation"`
+		Objects   []batchObject `json:"objects"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	objects := make([]batchObject, 0, len(request.Objects))
+	for _, object := range request.Objects {
+		_, stored := server.objects[object.OID]
+		object.Actions = make(map[string]*batchAction)
+
+		switch {
+		case request.Operation == "upload" && !stored:
+			object.Actions["upload"] = &batchAction{
+				Href:   server.URL + "/upload/" + object.OID,
+				Header: map[string]string{"Authorization": "RemoteAuth upload"},
+			}
+
+			if server.verify {
+				object.Actions["verify"] = &batchAction{Href: server.URL + "/verify"}
+			}
+		case request.Operation == "download" && stored:
+			object.Actions["download"] = &batchAction{Href: server.URL + "/download/" + object.OID}
+		}
+
+		objects = append(objects, object)
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"transfer": "basic",
+		"objects":  objects,
+	})
+}
+
+func (server *lfsServer) upload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut || r.Header.Get("Authorization") != "RemoteAuth upload" {
+		http.Error(w, "unexpected upload", http.StatusBadRequest)
+		return
+	}
+
+	contents, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.uploads++
+	server.objects[strings.TrimPrefix(r.URL.Path, "/upload/")] = contents
+}
+
+func (server *lfsServer) verifyUpload(w http.ResponseWriter, r *http.Request) {
+	var object batchObject
+	if err := json.NewDecoder(r.Body).Decode(&object); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if contents, ok := server.objects[object.OID]; !ok || int64(len(contents)) != object.Size {
+		http.Error(w, "object not uploaded", http.StatusNotFound)
+		return
+	}
+
+	server.verified = append(server.verified, object.OID)
+}
+
+func (server *lfsServer) download(w http.ResponseWriter, r *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	contents := server.objects[strings.TrimPrefix(r.URL.Path, "/download/")]
+	if server.corrupt {
+		contents = append([]byte("corrupt "), contents...)
+	}
+
+	_, _ = w.Write(contents)
+}
+
+func TestUpload(t *testing.T) {
+	server := newLFSServer(t)
+	client := NewClient(server.URL, "", "", time.Minute)
+
+	contents := []byte(`{"version": 4}`)
+
+	pointer, err := client.Upload(contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *pointer != *NewPointer(contents) {
+		t.Errorf("pointer = %+v, want %+v", pointer, NewPointer(contents))
+	}
+
+	if !bytes.Equal(server.objects[pointer.OID], contents) {
+		t.Errorf("stored %q, want %q", server.objects[pointer.OID], contents)
+	}
+
+	if len(server.verified) != 0 {
+		t.Errorf("verified %v without being asked to", server.verified)
+	}
+}
+
+func TestUploadAlreadyPresent(t *testing.T) {
+	server := newLFSServer(t)
+	client := NewClient(server.URL, "", "", time.Minute)
+
+	contents := []byte(`{"version": 4}`)
+	server.objects[NewPointer(contents).OID] = contents
+
+	if _, err := client.Upload(contents); err != nil {
+		t.Fatal(err)
+	}
+
+	if server.uploads != 0 {
+		t.Errorf("uploaded %d times, want no upload", server.uploads)
+	}
+}
+
+func TestUploadVerify(t *testing.T) {
+	server := newLFSServer(t)
+	server.verify = true
+	client := NewClient(server.URL, "", "", time.Minute)
+
+	pointer, err := client.Upload([]byte(`{"version": 4}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(server.verified) != 1 || server.verified[0] != pointer.OID {
+		t.Errorf("verified %v, want [%s]", server.verified, pointer.OID)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	server := newLFSServer(t)
+	client := NewClient(server.URL, "", "", time.Minute)
+
+	contents := []byte(`{"version": 4}`)
+	pointer := NewPointer(contents)
+	server.objects[pointer.OID] = contents
+
+	downloaded, err := client.Download(pointer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(downloaded, contents) {
+		t.Errorf("downloaded %q, want %q", downloaded, contents)
+	}
+}
+
+func TestDownloadOIDMismatch(t *testing.T) {
+	server := newLFSServer(t)
+	server.corrupt = true
+	client := NewClient(server.URL, "", "", time.Minute)
+
+	contents := []byte(`{"version": 4}`)
+	pointer := NewPointer(contents)
+	server.objects[pointer.OID] = contents
+
+	if _, err := client.Download(pointer); err == nil || !strings.Contains(err.Error(), "corrupt") {
+		t.Errorf("err = %v, want corrupt object", err)
+	}
+}
+
+func TestDownloadMissing(t *testing.T) {
+	server := newLFSServer(t)
+	client := NewClient(server.URL, "", "", time.Minute)
+
+	if _, err := client.Download(NewPointer([]byte("missing"))); err == nil {
+		t.Error("downloaded an object the server doesn't have")
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewClient(server.URL, "", "", 50*time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.Upload([]byte(`{"version": 4}`))
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("upload to a hanging server succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("upload to a hanging server didn't time out")
+	}
+}
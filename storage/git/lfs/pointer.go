@@ -0,0 +1,70 @@
+package lfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pointerVersion is the spec the pointer files are written in.
+// See https://github.com/git-lfs/git-lfs/blob/main/docs/spec.md.
+const pointerVersion = "https://git-lfs.github.com/spec/v1"
+
+// Pointer is what gets committed in place of a file stored in LFS.
+type Pointer struct {
+	// OID is the SHA-256 of the file contents, hex encoded
+	OID string
+
+	// Size of the file contents in bytes
+	Size int64
+}
+
+// NewPointer creates the pointer to the contents.
+func NewPointer(contents []byte) *Pointer {
+	sum := sha256.Sum256(contents)
+
+	return &Pointer{
+		OID:  hex.EncodeToString(sum[:]),
+		Size: int64(len(contents)),
+	}
+}
+
+// Encode encodes the pointer file.
+func (pointer *Pointer) Encode() []byte {
+	return []byte(fmt.Sprintf("version %s\noid sha256:%s\nsize %d\n", pointerVersion, pointer.OID, pointer.Size))
+}
+
+// ParsePointer parses the pointer file, it returns false if the contents aren't a pointer file.
+func ParsePointer(contents []byte) (*Pointer, bool) {
+	if !bytes.HasPrefix(contents, []byte("version "+pointerVersion+"\n")) {
+		return nil, false
+	}
+
+	pointer := &Pointer{}
+	for _, line := range strings.Split(strings.TrimSpace(string(contents)), "\n")[1:] {
+		key, value, _ := strings.Cut(line, " ")
+
+		switch key {
+		case "oid":
+			if !strings.HasPrefix(value, "sha256:") {
+				return nil, false
+			}
+			pointer.OID = strings.TrimPrefix(value, "sha256:")
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, false
+			}
+			pointer.Size = size
+		}
+	}
+
+	if pointer.OID == "" {
+		return nil, false
+	}
+
+	return pointer, true
+}
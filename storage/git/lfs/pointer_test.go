@@ -0,0 +1,77 @@
+package lfs
+
+import (
+	"testing"
+)
+
+func TestParsePointer(t *testing.T) {
+	const oid = "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+
+	tests := []struct {
+		name     string
+		contents string
+		want     *Pointer
+	}{
+		{
+			name:     "pointer",
+			contents: "version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize 12345\n",
+			want:     &Pointer{OID: oid, Size: 12345},
+		},
+		{
+			name:     "unknown keys",
+			contents: "version https://git-lfs.github.com/spec/v1\next-0-foo sha256:abc\noid sha256:" + oid + "\nsize 1\n",
+			want:     &Pointer{OID: oid, Size: 1},
+		},
+		{
+			name:     "state",
+			contents: `{"version": 4, "serial": 1}`,
+		},
+		{
+			name:     "other spec",
+			contents: "version https://hawser.github.com/spec/v1\noid sha256:" + oid + "\nsize 1\n",
+		},
+		{
+			name:     "other hash",
+			contents: "version https://git-lfs.github.com/spec/v1\noid sha1:" + oid[:40] + "\nsize 1\n",
+		},
+		{
+			name:     "invalid size",
+			contents: "version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize many\n",
+		},
+		{
+			name:     "no oid",
+			contents: "version https://git-lfs.github.com/spec/v1\nsize 1\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pointer, ok := ParsePointer([]byte(test.contents))
+
+			if test.want == nil {
+				if ok {
+					t.Errorf("parsed %+v, want no pointer", pointer)
+				}
+				return
+			}
+
+			if !ok || *pointer != *test.want {
+				t.Errorf("parsed %+v (%t), want %+v", pointer, ok, test.want)
+			}
+		})
+	}
+}
+
+func TestPointerEncode(t *testing.T) {
+	contents := []byte(`{"version": 4}`)
+	pointer := NewPointer(contents)
+
+	parsed, ok := ParsePointer(pointer.Encode())
+	if !ok || *parsed != *pointer {
+		t.Errorf("parsed %+v (%t), want %+v", parsed, ok, pointer)
+	}
+
+	if pointer.Size != int64(len(contents)) {
+		t.Errorf("size = %d, want %d", pointer.Size, len(contents))
+	}
+}
@@ -1,9 +1,36 @@
 package git
 
-import "fmt"
+import (
+	"fmt"
+	"terraform-backend-http-proxy/storage/storagetypes"
+)
 
 type requestMetadataParams struct {
 	Repository, Ref, State string
+
+	// lockID is the ID of the lock the caller holds, it's empty if unknown
+	lockID string
+
+	// expiredOnly releases the lock only while it's expired
+	expiredOnly bool
+
+	// update describes the state being stored, it's nil if unknown
+	update *storagetypes.StateUpdate
+}
+
+// SetLockID implements storage.LockIDMetadata
+func (params *requestMetadataParams) SetLockID(id string) {
+	params.lockID = id
+}
+
+// SetExpiredOnly implements storage.ExpiredLockMetadata
+func (params *requestMetadataParams) SetExpiredOnly() {
+	params.expiredOnly = true
+}
+
+// SetStateUpdate implements storage.StateUpdateMetadata
+func (params *requestMetadataParams) SetStateUpdate(update *storagetypes.StateUpdate) {
+	params.update = update
 }
 
 // String is a human-readable representation for this params set
@@ -0,0 +1,87 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"os"
+)
+
+// migrationLockID is the advisory lock key serializing schema migrations
+// between multiple proxies sharing the same database.
+const migrationLockID = 6061
+
+// migrations are applied in order on first use; every statement must be idempotent.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS tf_states (
+		workspace  TEXT PRIMARY KEY,
+		state      BYTEA NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`CREATE TABLE IF NOT EXISTS tf_state_versions (
+		id         BIGSERIAL PRIMARY KEY,
+		workspace  TEXT NOT NULL,
+		state      BYTEA NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`CREATE INDEX IF NOT EXISTS tf_state_versions_workspace_idx ON tf_state_versions (workspace, id)`,
+	`CREATE TABLE IF NOT EXISTS tf_locks (
+		workspace TEXT PRIMARY KEY,
+		id        TEXT NOT NULL,
+		operation TEXT NOT NULL,
+		info      TEXT NOT NULL,
+		who       TEXT NOT NULL,
+		version   TEXT NOT NULL,
+		created   TIMESTAMPTZ NOT NULL,
+		path      TEXT NOT NULL
+	)`,
+	`ALTER TABLE tf_locks ADD COLUMN IF NOT EXISTS expires TIMESTAMPTZ`,
+}
+
+// openDB connects to the database configured with TF_BACKEND_HTTP_PG_CONN_STR
+// and makes sure the schema is up-to-date.
+func openDB() (*sql.DB, error) {
+	connStr, ok := os.LookupEnv("TF_BACKEND_HTTP_PG_CONN_STR")
+	if !ok {
+		return nil, errors.New("postgres storage requires TF_BACKEND_HTTP_PG_CONN_STR to be set")
+	}
+
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// migrate applies all migrations within a single transaction.
+func migrate(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", migrationLockID); err != nil {
+		return err
+	}
+
+	for _, migration := range migrations {
+		if _, err := tx.Exec(migration); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// isUniqueViolation reports whether err was caused by a unique constraint.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
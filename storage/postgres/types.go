@@ -0,0 +1,28 @@
+package postgres
+
+import "fmt"
+
+type requestMetadataParams struct {
+	Workspace string
+
+	// lockID is the ID of the lock the caller holds, it's empty if unknown
+	lockID string
+
+	// expiredOnly releases the lock only while it's expired
+	expiredOnly bool
+}
+
+// SetLockID implements storage.LockIDMetadata
+func (params *requestMetadataParams) SetLockID(id string) {
+	params.lockID = id
+}
+
+// SetExpiredOnly implements storage.ExpiredLockMetadata
+func (params *requestMetadataParams) SetExpiredOnly() {
+	params.expiredOnly = true
+}
+
+// String is a human-readable representation for this params set
+func (params *requestMetadataParams) String() string {
+	return fmt.Sprintf("postgres://%s", params.Workspace)
+}
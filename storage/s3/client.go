@@ -0,0 +1,193 @@
+package s3
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gin-gonic/gin"
+	"os"
+	"sync"
+	"terraform-backend-http-proxy/storage/internal"
+	"terraform-backend-http-proxy/storage/storagetypes"
+)
+
+// StorageClient implementation for S3 storage type
+type StorageClient struct {
+	// api is the S3 API client, created on first use
+	api *s3.S3
+
+	// apiMutex used for locking while creating the api client
+	apiMutex sync.Mutex
+}
+
+// NewStorageClient creates new StorageClient
+func NewStorageClient() *StorageClient {
+	return &StorageClient{
+		apiMutex: sync.Mutex{},
+	}
+}
+
+func (client *StorageClient) CreateParams(params *gin.Context) storage.ClientTypeMetadata {
+	return &requestMetadataParams{
+		Bucket: params.Query("bucket"),
+		Key:    params.Query("key"),
+	}
+}
+
+func (client *StorageClient) GetLockData(data storage.ClientTypeMetadata) (*storagetypes.LockInfo, error) {
+	params := data.(*requestMetadataParams)
+
+	api, err := client.getAPI()
+	if err != nil {
+		return nil, err
+	}
+
+	lockInfo, _, err := readLock(api, params)
+	return lockInfo, err
+}
+
+func (client *StorageClient) LockState(data storage.ClientTypeMetadata, rawLockData []byte) error {
+	params := data.(*requestMetadataParams)
+
+	api, err := client.getAPI()
+	if err != nil {
+		return err
+	}
+
+	if err := putObject(api, params.Bucket, getLockKey(params), rawLockData, true); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return storagetypes.ErrLockExists
+		}
+		return err
+	}
+
+	return nil
+}
+
+// UnlockState only releases the lock of the caller, it might have been released and acquired by someone else meanwhile.
+// The lock object is only deleted if it's still the version read before.
+func (client *StorageClient) UnlockState(data storage.ClientTypeMetadata) error {
+	params := data.(*requestMetadataParams)
+
+	api, err := client.getAPI()
+	if err != nil {
+		return err
+	}
+
+	lockInfo, etag, err := readLock(api, params)
+	if err != nil {
+		if errors.Is(err, storagetypes.ErrLockMissing) {
+			return nil
+		}
+		return err
+	}
+
+	if lockInfo.ID != params.lockID {
+		return nil
+	}
+
+	// The expired lock was renewed in the meantime
+	if params.expiredOnly && !lockInfo.Expired() {
+		return nil
+	}
+
+	if err := deleteObjectAt(api, params.Bucket, getLockKey(params), etag); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// RenewLock only replaces the lock object if it's still the version of the same lock read before.
+func (client *StorageClient) RenewLock(data storage.ClientTypeMetadata, rawLockData []byte) error {
+	params := data.(*requestMetadataParams)
+
+	var renewed storagetypes.LockInfo
+	if err := json.Unmarshal(rawLockData, &renewed); err != nil {
+		return err
+	}
+
+	api, err := client.getAPI()
+	if err != nil {
+		return err
+	}
+
+	lockInfo, etag, err := readLock(api, params)
+	if err != nil {
+		return err
+	}
+
+	if lockInfo.ID != renewed.ID {
+		return storagetypes.ErrLockMissing
+	}
+
+	if err := replaceObject(api, params.Bucket, getLockKey(params), rawLockData, etag); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return storagetypes.ErrLockMissing
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (client *StorageClient) GetState(data storage.ClientTypeMetadata) ([]byte, error) {
+	params := data.(*requestMetadataParams)
+
+	api, err := client.getAPI()
+	if err != nil {
+		return nil, err
+	}
+
+	return getObject(api, params.Bucket, params.Key)
+}
+
+func (client *StorageClient) UpdateState(data storage.ClientTypeMetadata, state []byte) error {
+	params := data.(*requestMetadataParams)
+
+	api, err := client.getAPI()
+	if err != nil {
+		return err
+	}
+
+	return putObject(api, params.Bucket, params.Key, state, false)
+}
+
+func (client *StorageClient) getAPI() (*s3.S3, error) {
+	client.apiMutex.Lock()
+	defer client.apiMutex.Unlock()
+
+	if client.api == nil {
+		api, err := newS3()
+		if err != nil {
+			return nil, err
+		}
+
+		client.api = api
+	}
+
+	return client.api, nil
+}
+
+// readLock reads the lock along with the ETag of the lock object.
+// It fails with storagetypes.ErrLockMissing if the state isn't locked.
+func readLock(api *s3.S3, params *requestMetadataParams) (*storagetypes.LockInfo, string, error) {
+	lock, etag, err := getObjectETag(api, params.Bucket, getLockKey(params))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, "", storagetypes.ErrLockMissing
+		}
+		return nil, "", err
+	}
+
+	var lockInfo storagetypes.LockInfo
+	if err := json.Unmarshal(lock, &lockInfo); err != nil {
+		return nil, "", err
+	}
+
+	return &lockInfo, etag, nil
+}
+
+func getLockKey(params *requestMetadataParams) string {
+	return params.Key + ".lock"
+}
@@ -0,0 +1,219 @@
+package s3
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"terraform-backend-http-proxy/storage/storagetypes"
+	"testing"
+	"time"
+)
+
+// newTestParams returns params for a state in the bucket set with TF_BACKEND_HTTP_S3_TEST_BUCKET, the test is skipped if there is none.
+// The client is configured as usual, e.g. for a local MinIO:
+//
+//	TF_BACKEND_HTTP_S3_TEST_BUCKET=states TF_BACKEND_HTTP_S3_ENDPOINT=http://localhost:9000 TF_BACKEND_HTTP_S3_FORCE_PATH_STYLE=true \
+//	TF_BACKEND_HTTP_S3_REGION=us-east-1 AWS_ACCESS_KEY_ID=minioadmin AWS_SECRET_ACCESS_KEY=minioadmin go test ./storage/s3
+func newTestParams(t *testing.T, client *StorageClient) *requestMetadataParams {
+	bucket, ok := os.LookupEnv("TF_BACKEND_HTTP_S3_TEST_BUCKET")
+	if !ok {
+		t.Skip("TF_BACKEND_HTTP_S3_TEST_BUCKET is not set")
+	}
+
+	params := &requestMetadataParams{
+		Bucket: bucket,
+		Key:    "test/" + t.Name() + "/" + strconv.FormatInt(time.Now().UnixNano(), 10) + ".tfstate",
+	}
+
+	t.Cleanup(func() {
+		api, err := client.getAPI()
+		if err != nil {
+			return
+		}
+
+		for _, key := range []string{params.Key, getLockKey(params)} {
+			_, etag, err := getObjectETag(api, params.Bucket, key)
+			if err == nil {
+				_ = deleteObjectAt(api, params.Bucket, key, etag)
+			}
+		}
+	})
+
+	return params
+}
+
+func lockData(t *testing.T, lockInfo storagetypes.LockInfo) []byte {
+	data, err := json.Marshal(lockInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func assertLockedBy(t *testing.T, client *StorageClient, params *requestMetadataParams, id string) {
+	t.Helper()
+
+	lockInfo, err := client.GetLockData(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lockInfo.ID != id {
+		t.Fatalf("locked by %q, want %q", lockInfo.ID, id)
+	}
+}
+
+func TestLockState(t *testing.T) {
+	client := NewStorageClient()
+	params := newTestParams(t, client)
+
+	if _, err := client.GetLockData(params); !errors.Is(err, storagetypes.ErrLockMissing) {
+		t.Fatalf("err = %v, want ErrLockMissing", err)
+	}
+
+	if err := client.LockState(params, lockData(t, storagetypes.LockInfo{ID: "L"})); err != nil {
+		t.Fatal(err)
+	}
+
+	// The conditional write (If-None-Match) doesn't replace the lock held already
+	if err := client.LockState(params, lockData(t, storagetypes.LockInfo{ID: "M"})); !errors.Is(err, storagetypes.ErrLockExists) {
+		t.Fatalf("err = %v, want ErrLockExists", err)
+	}
+
+	assertLockedBy(t, client, params, "L")
+}
+
+func TestUnlockState(t *testing.T) {
+	client := NewStorageClient()
+	params := newTestParams(t, client)
+
+	if err := client.LockState(params, lockData(t, storagetypes.LockInfo{ID: "L"})); err != nil {
+		t.Fatal(err)
+	}
+
+	// Someone else's lock is kept
+	params.SetLockID("M")
+	if err := client.UnlockState(params); err != nil {
+		t.Fatal(err)
+	}
+
+	assertLockedBy(t, client, params, "L")
+
+	params.SetLockID("L")
+	if err := client.UnlockState(params); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.GetLockData(params); !errors.Is(err, storagetypes.ErrLockMissing) {
+		t.Fatalf("err = %v, want ErrLockMissing", err)
+	}
+}
+
+func TestUnlockStateExpiredOnly(t *testing.T) {
+	client := NewStorageClient()
+	params := newTestParams(t, client)
+
+	expires := time.Now().Add(time.Hour)
+	if err := client.LockState(params, lockData(t, storagetypes.LockInfo{ID: "L", Expires: &expires})); err != nil {
+		t.Fatal(err)
+	}
+
+	// The lock was renewed after it was found expired, so it's kept
+	params.SetLockID("L")
+	params.SetExpiredOnly()
+	if err := client.UnlockState(params); err != nil {
+		t.Fatal(err)
+	}
+
+	assertLockedBy(t, client, params, "L")
+}
+
+func TestDeleteChangedLock(t *testing.T) {
+	client := NewStorageClient()
+	params := newTestParams(t, client)
+
+	if err := client.LockState(params, lockData(t, storagetypes.LockInfo{ID: "L"})); err != nil {
+		t.Fatal(err)
+	}
+
+	api, err := client.getAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, etag, err := readLock(api, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.RenewLock(params, lockData(t, storagetypes.LockInfo{ID: "L", Info: "renewed"})); err != nil {
+		t.Fatal(err)
+	}
+
+	// The conditional delete (If-Match) doesn't remove the lock changed since reading it
+	if err := deleteObjectAt(api, params.Bucket, getLockKey(params), etag); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("err = %v, want os.ErrNotExist", err)
+	}
+
+	assertLockedBy(t, client, params, "L")
+}
+
+func TestRenewLock(t *testing.T) {
+	client := NewStorageClient()
+	params := newTestParams(t, client)
+
+	if err := client.LockState(params, lockData(t, storagetypes.LockInfo{ID: "L"})); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.RenewLock(params, lockData(t, storagetypes.LockInfo{ID: "L", Info: "renewed"})); err != nil {
+		t.Fatal(err)
+	}
+
+	lockInfo, err := client.GetLockData(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lockInfo.Info != "renewed" {
+		t.Errorf("info = %q, want renewed", lockInfo.Info)
+	}
+
+	// Someone else's lock isn't renewed
+	if err := client.RenewLock(params, lockData(t, storagetypes.LockInfo{ID: "M"})); !errors.Is(err, storagetypes.ErrLockMissing) {
+		t.Fatalf("err = %v, want ErrLockMissing", err)
+	}
+
+	api, err := client.getAPI()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The conditional write (If-Match) doesn't replace a lock changed since reading it
+	if err := replaceObject(api, params.Bucket, getLockKey(params), lockData(t, storagetypes.LockInfo{ID: "M"}), `"stale"`); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("err = %v, want os.ErrNotExist", err)
+	}
+
+	assertLockedBy(t, client, params, "L")
+}
+
+func TestState(t *testing.T) {
+	client := NewStorageClient()
+	params := newTestParams(t, client)
+
+	state := []byte(`{"version": 4, "serial": 1}`)
+	if err := client.UpdateState(params, state); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := client.GetState(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(stored) != string(state) {
+		t.Errorf("state = %s, want %s", stored, state)
+	}
+}
@@ -0,0 +1,163 @@
+package s3
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// newS3 creates an S3 API client configured from the environment.
+// Credentials are resolved through the default AWS credential chain.
+func newS3() (*s3.S3, error) {
+	config := aws.NewConfig()
+
+	if region, ok := os.LookupEnv("TF_BACKEND_HTTP_S3_REGION"); ok {
+		config = config.WithRegion(region)
+	}
+
+	// Custom endpoints are needed for S3-compatible storages like MinIO
+	if endpoint, ok := os.LookupEnv("TF_BACKEND_HTTP_S3_ENDPOINT"); ok {
+		config = config.WithEndpoint(endpoint)
+	}
+
+	if pathStyle, ok := os.LookupEnv("TF_BACKEND_HTTP_S3_FORCE_PATH_STYLE"); ok {
+		forcePathStyle, err := strconv.ParseBool(pathStyle)
+		if err != nil {
+			return nil, err
+		}
+		config = config.WithS3ForcePathStyle(forcePathStyle)
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *config,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s3.New(sess), nil
+}
+
+// getObject reads the object with the given key.
+// A missing object is reported as os.ErrNotExist.
+func getObject(api *s3.S3, bucket, key string) ([]byte, error) {
+	buf, _, err := getObjectETag(api, bucket, key)
+	return buf, err
+}
+
+// getObjectETag reads the object with the given key along with its ETag, identifying the version read.
+// A missing object is reported as os.ErrNotExist.
+func getObjectETag(api *s3.S3, bucket, key string) ([]byte, string, error) {
+	output, err := api.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, "", fmt.Errorf("s3://%s/%s: %w", bucket, key, os.ErrNotExist)
+		}
+		return nil, "", err
+	}
+	defer output.Body.Close()
+
+	buf, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return buf, aws.StringValue(output.ETag), nil
+}
+
+// putObject writes buf to the object with the given key.
+// If exclusive was true, the write only succeeds when the object doesn't exist yet,
+// otherwise an error satisfying os.ErrExist is returned.
+func putObject(api *s3.S3, bucket, key string, buf []byte, exclusive bool) error {
+	req, _ := api.PutObjectRequest(&s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(buf),
+	})
+
+	if exclusive {
+		req.HTTPRequest.Header.Set("If-None-Match", "*")
+	}
+
+	if err := req.Send(); err != nil {
+		if exclusive && isPreconditionFailed(err) {
+			return fmt.Errorf("s3://%s/%s: %w", bucket, key, os.ErrExist)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// replaceObject writes buf to the object with the given key, as long as it's still the version with the given ETag.
+// Otherwise an error satisfying os.ErrNotExist is returned, since that version doesn't exist anymore.
+func replaceObject(api *s3.S3, bucket, key string, buf []byte, etag string) error {
+	req, _ := api.PutObjectRequest(&s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(buf),
+	})
+
+	req.HTTPRequest.Header.Set("If-Match", etag)
+
+	if err := req.Send(); err != nil {
+		if isPreconditionFailed(err) || isNotFound(err) {
+			return fmt.Errorf("s3://%s/%s: %w", bucket, key, os.ErrNotExist)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// deleteObjectAt removes the object with the given key, as long as it's still the version with the given ETag.
+// Otherwise an error satisfying os.ErrNotExist is returned, since that version doesn't exist anymore.
+func deleteObjectAt(api *s3.S3, bucket, key string, etag string) error {
+	req, _ := api.DeleteObjectRequest(&s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+
+	req.HTTPRequest.Header.Set("If-Match", etag)
+
+	if err := req.Send(); err != nil {
+		if isPreconditionFailed(err) || isNotFound(err) {
+			return fmt.Errorf("s3://%s/%s: %w", bucket, key, os.ErrNotExist)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func isNotFound(err error) bool {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchKey {
+		return true
+	}
+
+	return hasStatusCode(err, http.StatusNotFound)
+}
+
+// isPreconditionFailed reports whether a conditional write was rejected.
+// Concurrent conditional writes to the same key may also be answered with a conflict.
+func isPreconditionFailed(err error) bool {
+	return hasStatusCode(err, http.StatusPreconditionFailed) || hasStatusCode(err, http.StatusConflict)
+}
+
+func hasStatusCode(err error, statusCode int) bool {
+	var reqErr awserr.RequestFailure
+	return errors.As(err, &reqErr) && reqErr.StatusCode() == statusCode
+}
@@ -0,0 +1,274 @@
+//go:build !(windows && 386)
+// +build !windows !386
+
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"os"
+	"sync"
+	"terraform-backend-http-proxy/storage/internal"
+	"terraform-backend-http-proxy/storage/storagetypes"
+	"time"
+)
+
+// StorageClient implementation for SQLite storage type
+type StorageClient struct {
+	// db is the connection pool, opened and migrated on first use
+	db *sql.DB
+
+	// dbMutex used for locking while opening the database
+	dbMutex sync.Mutex
+}
+
+// NewStorageClient creates new StorageClient
+func NewStorageClient() *StorageClient {
+	return &StorageClient{
+		dbMutex: sync.Mutex{},
+	}
+}
+
+func (client *StorageClient) CreateParams(params *gin.Context) storage.ClientTypeMetadata {
+	return &requestMetadataParams{
+		Workspace: params.Query("workspace"),
+	}
+}
+
+func (client *StorageClient) GetLockData(data storage.ClientTypeMetadata) (*storagetypes.LockInfo, error) {
+	params := data.(*requestMetadataParams)
+
+	db, err := client.getDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var lockInfo storagetypes.LockInfo
+	var expires sql.NullTime
+	row := db.QueryRow(
+		`SELECT id, operation, info, who, version, created, path, expires FROM locks WHERE workspace = ?`,
+		params.Workspace,
+	)
+	if err := row.Scan(
+		&lockInfo.ID,
+		&lockInfo.Operation,
+		&lockInfo.Info,
+		&lockInfo.Who,
+		&lockInfo.Version,
+		&lockInfo.Created,
+		&lockInfo.Path,
+		&expires,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storagetypes.ErrLockMissing
+		}
+		return nil, err
+	}
+
+	if expires.Valid {
+		lockInfo.Expires = &expires.Time
+	}
+
+	return &lockInfo, nil
+}
+
+func (client *StorageClient) LockState(data storage.ClientTypeMetadata, rawLockData []byte) error {
+	params := data.(*requestMetadataParams)
+
+	var lockInfo storagetypes.LockInfo
+	if err := json.Unmarshal(rawLockData, &lockInfo); err != nil {
+		return err
+	}
+
+	db, err := client.getDB()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The primary key on workspace guarantees only one lock can be inserted
+	result, err := tx.Exec(
+		`INSERT INTO locks (workspace, id, operation, info, who, version, created, path, expires)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (workspace) DO NOTHING`,
+		params.Workspace,
+		lockInfo.ID,
+		lockInfo.Operation,
+		lockInfo.Info,
+		lockInfo.Who,
+		lockInfo.Version,
+		lockInfo.Created,
+		lockInfo.Path,
+		lockInfo.Expires,
+	)
+	if err != nil {
+		return err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if inserted == 0 {
+		return storagetypes.ErrLockExists
+	}
+
+	return tx.Commit()
+}
+
+// UnlockState only releases the lock of the caller, it might have been released and acquired by someone else meanwhile.
+func (client *StorageClient) UnlockState(data storage.ClientTypeMetadata) error {
+	params := data.(*requestMetadataParams)
+
+	db, err := client.getDB()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id string
+	var expires sql.NullTime
+	row := tx.QueryRow(`SELECT id, expires FROM locks WHERE workspace = ?`, params.Workspace)
+	if err := row.Scan(&id, &expires); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	if id != params.lockID {
+		return nil
+	}
+
+	// The expired lock was renewed in the meantime
+	if params.expiredOnly && !(expires.Valid && time.Now().After(expires.Time)) {
+		return nil
+	}
+
+	if _, err := tx.Exec(`DELETE FROM locks WHERE workspace = ? AND id = ?`, params.Workspace, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RenewLock only updates the expiry, the rest of the lock data doesn't change while it's held.
+func (client *StorageClient) RenewLock(data storage.ClientTypeMetadata, rawLockData []byte) error {
+	params := data.(*requestMetadataParams)
+
+	var lockInfo storagetypes.LockInfo
+	if err := json.Unmarshal(rawLockData, &lockInfo); err != nil {
+		return err
+	}
+
+	db, err := client.getDB()
+	if err != nil {
+		return err
+	}
+
+	result, err := db.Exec(
+		`UPDATE locks SET expires = ? WHERE workspace = ? AND id = ?`,
+		lockInfo.Expires,
+		params.Workspace,
+		lockInfo.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if updated == 0 {
+		return storagetypes.ErrLockMissing
+	}
+
+	return nil
+}
+
+func (client *StorageClient) GetState(data storage.ClientTypeMetadata) ([]byte, error) {
+	params := data.(*requestMetadataParams)
+
+	db, err := client.getDB()
+	if err != nil {
+		return nil, err
+	}
+
+	var state []byte
+	row := db.QueryRow(`SELECT state FROM states WHERE workspace = ?`, params.Workspace)
+	if err := row.Scan(&state); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%s: %w", params, os.ErrNotExist)
+		}
+		return nil, err
+	}
+
+	return state, nil
+}
+
+func (client *StorageClient) UpdateState(data storage.ClientTypeMetadata, state []byte) error {
+	params := data.(*requestMetadataParams)
+
+	db, err := client.getDB()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`INSERT INTO states (workspace, state, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT (workspace) DO UPDATE SET state = EXCLUDED.state, updated_at = EXCLUDED.updated_at`,
+		params.Workspace,
+		state,
+	); err != nil {
+		return err
+	}
+
+	// Every update is retained in the history
+	if _, err := tx.Exec(
+		`INSERT INTO state_history (workspace, state) VALUES (?, ?)`,
+		params.Workspace,
+		state,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (client *StorageClient) getDB() (*sql.DB, error) {
+	client.dbMutex.Lock()
+	defer client.dbMutex.Unlock()
+
+	if client.db == nil {
+		db, err := openDB()
+		if err != nil {
+			return nil, err
+		}
+
+		client.db = db
+	}
+
+	return client.db, nil
+}
@@ -0,0 +1,104 @@
+//go:build !(windows && 386)
+// +build !windows !386
+
+package sqlite
+
+import (
+	"database/sql"
+	"os"
+
+	_ "modernc.org/sqlite"
+)
+
+// migrations are applied in order on first use; every statement must be idempotent.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS states (
+		workspace  TEXT PRIMARY KEY,
+		state      BLOB NOT NULL,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE TABLE IF NOT EXISTS state_history (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		workspace  TEXT NOT NULL,
+		state      BLOB NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE INDEX IF NOT EXISTS state_history_workspace_idx ON state_history (workspace, id)`,
+	`CREATE TABLE IF NOT EXISTS locks (
+		workspace TEXT PRIMARY KEY,
+		id        TEXT NOT NULL,
+		operation TEXT NOT NULL,
+		info      TEXT NOT NULL,
+		who       TEXT NOT NULL,
+		version   TEXT NOT NULL,
+		created   TIMESTAMP NOT NULL,
+		path      TEXT NOT NULL
+	)`,
+}
+
+// addedColumns are added to existing tables after the migrations, SQLite has no ADD COLUMN IF NOT EXISTS.
+var addedColumns = []struct {
+	table, column, definition string
+}{
+	{"locks", "expires", "TIMESTAMP"},
+}
+
+// databasePath returns the SQLite file configured with TF_BACKEND_HTTP_SQLITE_PATH.
+func databasePath() string {
+	if path, ok := os.LookupEnv("TF_BACKEND_HTTP_SQLITE_PATH"); ok && path != "" {
+		return path
+	}
+
+	return "terraform-backend-http-proxy.db"
+}
+
+// openDB opens the database file and makes sure the schema is up-to-date.
+func openDB() (*sql.DB, error) {
+	db, err := sql.Open("sqlite", databasePath())
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only allows a single writer, so we serialize all access instead of failing with SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// migrate applies all migrations within a single transaction.
+func migrate(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, migration := range migrations {
+		if _, err := tx.Exec(migration); err != nil {
+			return err
+		}
+	}
+
+	for _, added := range addedColumns {
+		var exists bool
+		row := tx.QueryRow(`SELECT COUNT(*) > 0 FROM pragma_table_info(?) WHERE name = ?`, added.table, added.column)
+		if err := row.Scan(&exists); err != nil {
+			return err
+		}
+
+		if exists {
+			continue
+		}
+
+		if _, err := tx.Exec(`ALTER TABLE ` + added.table + ` ADD COLUMN ` + added.column + ` ` + added.definition); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
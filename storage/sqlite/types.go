@@ -0,0 +1,31 @@
+//go:build !(windows && 386)
+// +build !windows !386
+
+package sqlite
+
+import "fmt"
+
+type requestMetadataParams struct {
+	Workspace string
+
+	// lockID is the ID of the lock the caller holds, it's empty if unknown
+	lockID string
+
+	// expiredOnly releases the lock only while it's expired
+	expiredOnly bool
+}
+
+// SetLockID implements storage.LockIDMetadata
+func (params *requestMetadataParams) SetLockID(id string) {
+	params.lockID = id
+}
+
+// SetExpiredOnly implements storage.ExpiredLockMetadata
+func (params *requestMetadataParams) SetExpiredOnly() {
+	params.expiredOnly = true
+}
+
+// String is a human-readable representation for this params set
+func (params *requestMetadataParams) String() string {
+	return fmt.Sprintf("sqlite://%s", params.Workspace)
+}
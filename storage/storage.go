@@ -3,8 +3,11 @@ package storage
 import (
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"terraform-backend-http-proxy/storage/file"
 	"terraform-backend-http-proxy/storage/git"
 	"terraform-backend-http-proxy/storage/internal"
+	"terraform-backend-http-proxy/storage/postgres"
+	"terraform-backend-http-proxy/storage/s3"
 	"terraform-backend-http-proxy/storage/storagetypes"
 )
 
@@ -13,6 +16,9 @@ var knownStorageTypes = make(map[string]Client)
 
 func init() {
 	knownStorageTypes["git"] = git.NewStorageClient()
+	knownStorageTypes["file"] = file.NewStorageClient()
+	knownStorageTypes["s3"] = s3.NewStorageClient()
+	knownStorageTypes["postgres"] = postgres.NewStorageClient()
 }
 
 // GetStorageClient gets the storage client based on the client
@@ -32,3 +38,40 @@ type Client interface {
 	GetState(storage.ClientTypeMetadata) ([]byte, error)
 	UpdateState(storage.ClientTypeMetadata, []byte) error
 }
+
+// HistoryClient is implemented by storage clients keeping the history of states.
+type HistoryClient interface {
+	// GetStateVersions lists the versions of the state, newest first.
+	// The Terraform serial and lineage are only set if the storage recorded them, otherwise the stored state is.
+	GetStateVersions(storage.ClientTypeMetadata) ([]storagetypes.StateVersion, error)
+	// GetStateVersion gets the raw state at the given version.
+	GetStateVersion(storage.ClientTypeMetadata, string) ([]byte, error)
+}
+
+// LockRenewClient is implemented by storage clients able to renew locks in place.
+type LockRenewClient interface {
+	// RenewLock replaces the lock data of the currently held lock.
+	// It fails with storagetypes.ErrLockMissing if the state isn't locked.
+	RenewLock(storage.ClientTypeMetadata, []byte) error
+}
+
+// StateUpdateMetadata is implemented by request metadata of storage clients describing the states they store,
+// e.g. in tags or commit messages.
+type StateUpdateMetadata interface {
+	// SetStateUpdate is called by the backend with the description of the state about to be stored.
+	SetStateUpdate(*storagetypes.StateUpdate)
+}
+
+// LockIDMetadata is implemented by request metadata of storage clients needing the ID of the lock the caller holds,
+// e.g. to only release that very lock.
+type LockIDMetadata interface {
+	// SetLockID is called by the backend with the ID of the lock the caller holds, if known.
+	SetLockID(string)
+}
+
+// ExpiredLockMetadata is implemented by request metadata of storage clients able to release expired locks only,
+// so a lock renewed while it's being released is kept.
+type ExpiredLockMetadata interface {
+	// SetExpiredOnly is called by the backend before releasing the expired lock of someone else.
+	SetExpiredOnly()
+}
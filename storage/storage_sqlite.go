@@ -0,0 +1,11 @@
+//go:build !(windows && 386)
+// +build !windows !386
+
+package storage
+
+import "terraform-backend-http-proxy/storage/sqlite"
+
+// SQLite isn't available on windows/386, since the pure Go driver doesn't support it
+func init() {
+	knownStorageTypes["sqlite"] = sqlite.NewStorageClient()
+}
@@ -5,4 +5,10 @@ import "errors"
 var (
 	// ErrLockMissing indicate that the lock didn't exist when it was expected/required to
 	ErrLockMissing = errors.New("was not locked")
+
+	// ErrLockExists indicate that the lock was acquired by someone else while trying to acquire it
+	ErrLockExists = errors.New("was already locked")
+
+	// ErrUntrustedState indicate that the state was refused since it's not signed by a trusted key
+	ErrUntrustedState = errors.New("state is not signed by a trusted key")
 )
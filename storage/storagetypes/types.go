@@ -44,4 +44,55 @@ type LockInfo struct {
 
 	// Path to the state file when applicable. Set by the Lock implementation.
 	Path string
+
+	// Expires is when the lock expires unless it's renewed, nil if it never does.
+	// It's not part of the Terraform lock metadata, the backend sets it if lock expiry is enabled.
+	Expires *time.Time `json:",omitempty"`
+}
+
+// Expired tells if the lock expired without being renewed.
+func (lockInfo *LockInfo) Expired() bool {
+	return lockInfo.Expires != nil && time.Now().After(*lockInfo.Expires)
+}
+
+// StateUpdate describes the Terraform state being stored.
+// The backend reads it from the state before it's encrypted, storage clients only get to see the encrypted state.
+type StateUpdate struct {
+	// Serial is the Terraform serial of the state, nil if it's not a Terraform state.
+	Serial *uint64
+
+	// Lineage is the Terraform lineage of the state.
+	Lineage string
+
+	// PreviousSerial is the Terraform serial of the replaced state.
+	PreviousSerial uint64
+
+	// Resources and PreviousResources are the numbers of resource instances in the state and the replaced state.
+	Resources, PreviousResources int
+
+	// Added, Changed and Removed count the resource instances that differ from the replaced state.
+	// They are zero if either state couldn't be read.
+	Added, Changed, Removed int
+}
+
+// StateVersion represents a single stored version of a state.
+type StateVersion struct {
+	// ID identifies the version within the storage, for Git this is the commit SHA.
+	ID string `json:"id"`
+
+	// Created is the time the version was stored.
+	Created time.Time `json:"created"`
+
+	// Author is who stored the version, when known by the storage.
+	Author string `json:"author"`
+
+	// Serial is the Terraform serial of the state.
+	Serial uint64 `json:"serial"`
+
+	// Lineage is the Terraform lineage of the state.
+	Lineage string `json:"lineage"`
+
+	// State is the stored state of versions the storage didn't record the serial and lineage of,
+	// so they can be read from it. It's nil if they were recorded or the state couldn't be read.
+	State []byte `json:"-"`
 }